@@ -0,0 +1,127 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+// TODO: Test the operand encodings, the SP forms in particular, against golden
+// output from 6a. Expectations written from a reading of 6a's rules would only
+// restate this package's own reading of them.
+
+var amd64SPTests = []struct {
+	input    string
+	severity Severity // Of the single diagnostic.
+}{
+	{"-8(SP)", Warning},
+	{"-8(SP)(AX*1)", Warning},
+	{"$foo(SB)(AX*4)", Error},
+	{"$8(SP)(AX*4)", Error},
+}
+
+func TestAmd64SP(t *testing.T) {
+	arch := archAmd64()
+	for _, test := range amd64SPTests {
+		p := newTestParser(arch)
+		addr := p.address(tokenize(test.input))
+		p.addrToAddr(&addr)
+		if len(p.diag.List) != 1 || p.diag.List[0].Severity != test.severity {
+			t.Errorf("%s: got %v; want one %s", test.input, p.diag.List, test.severity)
+		}
+	}
+}
+
+// liblink has no AVX instructions, so the three-operand VEX forms are rejected; see x86Shapes.
+func TestAmd64NoVEX(t *testing.T) {
+	src := "TEXT foo(SB), 0, $0\nVPADDD X1, X2, X3\n"
+	obj, diags := Assemble("amd64", "x.s", strings.NewReader(src), Options{})
+	if obj != nil || len(diags) != 1 || diags[0].Msg != "unrecognized instruction VPADDD" {
+		t.Errorf("got %v, %v; want unrecognized instruction VPADDD", obj, diags)
+	}
+}
+
+// Each of these has operands that do not fit any shape of its instruction.
+var amd64BadShapeTests = []string{
+	"MOVQ AX, BX, CX",
+	"MOVQ $4, DX:AX",
+	"SHLQ $4, DX:AX, BX",
+	"SHLQ $4, $1, DX",
+	"CMPPS X1, X0, $4",
+	"IMUL3Q 5, AX, BX",
+}
+
+func TestAmd64BadShape(t *testing.T) {
+	for _, input := range amd64BadShapeTests {
+		src := "TEXT foo(SB), 0, $0\n" + input + "\n"
+		if obj, _ := Assemble("amd64", "x.s", strings.NewReader(src), Options{}); obj != nil {
+			t.Errorf("%s: assembled without error", input)
+		}
+	}
+}
+
+var amd64ClassTests = []struct {
+	input string
+	msg   string // Expected diagnostic; empty if the instruction is valid.
+}{
+	{"MOVL $1, $2", "MOVL: destination must be register or memory"},
+	{"MOVL $0x100000000, AX", "MOVL: source must be register, memory, 32-bit immediate or address"},
+	{"MOVQ $0x100000000, AX", ""},
+	{"MOVB $256, AL", "MOVB: source must be register, memory, 8-bit immediate or address"},
+	{"MOVW $0x10000, AX", "MOVW: source must be register, memory, 16-bit immediate or address"},
+	{"MOVW $-1, AX", ""},
+	{"ADDW $0xffff, AX", ""},
+	{"MOVQ X0, AX", ""},
+	{"MOVQ (AX), (BX)", "MOVQ: at most one operand may be memory"},
+	{"ADDQ X0, AX", "ADDQ: source must be general register, memory, 32-bit immediate or address"},
+	{"CMPQ AX, $0", ""},
+	{"CMPL AX, $runtime·x(SB)", ""},
+	{"SHLQ $256, AX", "SHLQ: source must be general register or 8-bit immediate"},
+	{"LEAQ AX, BX", "LEAQ: source must be memory"},
+	{"INCQ $1", "INCQ: destination must be register or memory"},
+	{"MOVQ FP, AX", "MOVQ: source must be register, memory, immediate or address"},
+	{"CMPPS X1, (AX), 4", ""},
+}
+
+// Every reference to a symbol uses the name liblink knows it by.
+func TestAmd64SymbolNames(t *testing.T) {
+	p := newTestParser(archAmd64())
+	p.asmText("TEXT", [][]LexToken{tokenize("a·b·f(SB)"), tokenize("0"), tokenize("$0")})
+	p.instruction(p.arch.instructions["MOVQ"], "MOVQ", [][]LexToken{tokenize("$a·b·x(SB)"), tokenize("AX")})
+	p.instruction(p.arch.instructions["CALL"], "CALL", [][]LexToken{tokenize("a·b·g(SB)")})
+	if p.diag.ErrorCount() != 0 {
+		t.Fatal("unexpected error")
+	}
+	var names []string
+	for prog := p.firstProg; prog != nil; prog = prog.Link {
+		for _, a := range []*liblink.Addr{&prog.From, &prog.To} {
+			if a.Sym != nil {
+				names = append(names, a.Sym.Name)
+			}
+		}
+	}
+	want := []string{"a.b.f", "a.b.x", "a.b.g"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q; want %q", names, want)
+	}
+}
+
+func TestAmd64Class(t *testing.T) {
+	for _, test := range amd64ClassTests {
+		src := "TEXT foo(SB), 0, $0\n" + test.input + "\n"
+		_, diags := Assemble("amd64", "x.s", strings.NewReader(src), Options{})
+		var msg string
+		if len(diags) > 0 {
+			msg = diags[0].Msg
+		}
+		if msg != test.msg {
+			t.Errorf("%s: got %q; want %q", test.input, msg, test.msg)
+		}
+	}
+}
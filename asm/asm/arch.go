@@ -0,0 +1,578 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+
+	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rsc/c2go/liblink/amd64"
+	"code.google.com/p/rsc/c2go/liblink/arm"
+	"code.google.com/p/rsc/c2go/liblink/ppc64"
+	"code.google.com/p/rsc/c2go/liblink/x86"
+)
+
+// Arch wraps the link architecture object with more architecture-specific information
+type Arch struct {
+	*liblink.LinkArch
+	D_INDIR        int // TODO: why not in LinkArch?
+	D_CONST2       int // TODO: why not in LinkArch?
+	SP             int
+	noAddr         liblink.Addr
+	regNone        int // Value of Prog.Reg meaning no register.
+	instructions   map[string]int
+	anames         []string        // Instruction names, indexed by opcode.
+	jumps          map[string]bool // Instructions that take a branch target, by name.
+	registers      map[string]int
+	pseudos        map[string]int         // TEXT, DATA etc.
+	shapes         map[int][]shape        // Operand shapes that differ from the defaults, by opcode.
+	defaultShapes  []shape                // Operand shapes by number of operands; nil if not allowed.
+	regClasses     map[int]class          // Classes of the x86 registers; see registerClass.
+	classes        map[int]operandClasses // Operand classes that differ from the defaults, by opcode.
+	defaultClasses operandClasses
+}
+
+// LookupArch returns the Arch for the named GOARCH, or nil if it is not supported.
+func LookupArch(GOARCH string) *Arch {
+	// TODO: Is this how to set this up?
+	switch GOARCH {
+	case "386":
+		return arch386()
+	case "amd64":
+		return archAmd64()
+	case "arm":
+		return archArm()
+	case "ppc64":
+		return archPPC64(&ppc64.Linkppc64)
+	case "ppc64le":
+		return archPPC64(&ppc64.Linkppc64le)
+	}
+	return nil
+}
+
+func arch386() *Arch {
+	noAddr := liblink.Addr{
+		Typ:   x86.D_NONE,
+		Index: x86.D_NONE,
+	}
+
+	registers := make(map[string]int)
+	// Create maps for easy lookup of instruction names etc.
+	// TODO: Should this be done in liblink for us?
+	for i, s := range x86.Regstr {
+		registers[s] = i
+	}
+	// Pseudo-registers.
+	registers["SB"] = rSB
+	registers["FP"] = rFP
+	registers["SP"] = rSP
+	registers["PC"] = rPC
+
+	instructions := make(map[string]int)
+	for i, s := range x86.Anames8 {
+		instructions[s] = i
+	}
+	// Annoying aliases.
+	instructions["JA"] = x86.AJHI
+	instructions["JAE"] = x86.AJCC
+	instructions["JB"] = x86.AJCS
+	instructions["JBE"] = x86.AJLS
+	instructions["JC"] = x86.AJCS
+	instructions["JE"] = x86.AJEQ
+	instructions["JG"] = x86.AJGT
+	instructions["JHS"] = x86.AJCC
+	instructions["JL"] = x86.AJLT
+	instructions["JLO"] = x86.AJCS
+	instructions["JNA"] = x86.AJLS
+	instructions["JNAE"] = x86.AJCS
+	instructions["JNB"] = x86.AJCC
+	instructions["JNBE"] = x86.AJHI
+	instructions["JNC"] = x86.AJCC
+	instructions["JNG"] = x86.AJLE
+	instructions["JNGE"] = x86.AJLT
+	instructions["JNL"] = x86.AJGE
+	instructions["JNLE"] = x86.AJGT
+	instructions["JNO"] = x86.AJOC
+	instructions["JNP"] = x86.AJPC
+	instructions["JNS"] = x86.AJPL
+	instructions["JNZ"] = x86.AJNE
+	instructions["JO"] = x86.AJOS
+	instructions["JP"] = x86.AJPS
+	instructions["JPE"] = x86.AJPS
+	instructions["JPO"] = x86.AJPC
+	instructions["JS"] = x86.AJMI
+	instructions["JZ"] = x86.AJEQ
+	instructions["MASKMOVDQU"] = x86.AMASKMOVOU
+	instructions["MOVOA"] = x86.AMOVO
+	instructions["MOVNTDQ"] = x86.AMOVNTO
+
+	pseudos := make(map[string]int) // TEXT, DATA etc.
+	pseudos["DATA"] = x86.ADATA
+	pseudos["FUNCDATA"] = x86.AFUNCDATA
+	pseudos["GLOBL"] = x86.AGLOBL
+	pseudos["PCDATA"] = x86.APCDATA
+	pseudos["TEXT"] = x86.ATEXT
+
+	return &Arch{
+		LinkArch:       &x86.Link386,
+		D_INDIR:        x86.D_INDIR,
+		D_CONST2:       x86.D_CONST2,
+		SP:             x86.D_SP,
+		noAddr:         noAddr,
+		instructions:   instructions,
+		anames:         x86.Anames8,
+		jumps:          x86Jumps(instructions),
+		registers:      registers,
+		pseudos:        pseudos,
+		shapes:         x86Shapes(instructions),
+		defaultShapes:  x86DefaultShapes,
+		regClasses:     x86RegisterClasses(registers),
+		classes:        x86Classes(instructions),
+		defaultClasses: operandClasses{slotTo: classRegisters | classMem},
+	}
+}
+
+func archAmd64() *Arch {
+	noAddr := liblink.Addr{
+		Typ:   amd64.D_NONE,
+		Index: amd64.D_NONE,
+	}
+
+	registers := make(map[string]int)
+	// Create maps for easy lookup of instruction names etc.
+	// TODO: Should this be done in liblink for us?
+	for i, s := range amd64.Regstr {
+		registers[s] = i
+	}
+	// Pseudo-registers.
+	registers["SB"] = rSB
+	registers["FP"] = rFP
+	registers["SP"] = rSP
+	registers["PC"] = rPC
+
+	instructions := make(map[string]int)
+	for i, s := range amd64.Anames6 {
+		instructions[s] = i
+	}
+	// Annoying aliases.
+	instructions["JB"] = amd64.AJCS
+	instructions["JC"] = amd64.AJCS
+	instructions["JNAE"] = amd64.AJCS
+	instructions["JLO"] = amd64.AJCS
+	instructions["JAE"] = amd64.AJCC
+	instructions["JNB"] = amd64.AJCC
+	instructions["JNC"] = amd64.AJCC
+	instructions["JHS"] = amd64.AJCC
+	instructions["JE"] = amd64.AJEQ
+	instructions["JZ"] = amd64.AJEQ
+	instructions["JNZ"] = amd64.AJNE
+	instructions["JBE"] = amd64.AJLS
+	instructions["JNA"] = amd64.AJLS
+	instructions["JA"] = amd64.AJHI
+	instructions["JNBE"] = amd64.AJHI
+	instructions["JS"] = amd64.AJMI
+	instructions["JNS"] = amd64.AJPL
+	instructions["JP"] = amd64.AJPS
+	instructions["JPE"] = amd64.AJPS
+	instructions["JNP"] = amd64.AJPC
+	instructions["JPO"] = amd64.AJPC
+	instructions["JL"] = amd64.AJLT
+	instructions["JNGE"] = amd64.AJLT
+	instructions["JNL"] = amd64.AJGE
+	instructions["JNG"] = amd64.AJLE
+	instructions["JG"] = amd64.AJGT
+	instructions["JNLE"] = amd64.AJGT
+	instructions["MASKMOVDQU"] = amd64.AMASKMOVOU
+	instructions["MOVD"] = amd64.AMOVQ
+	instructions["MOVDQ2Q"] = amd64.AMOVQ
+
+	pseudos := make(map[string]int) // TEXT, DATA etc.
+	pseudos["DATA"] = amd64.ADATA
+	pseudos["FUNCDATA"] = amd64.AFUNCDATA
+	pseudos["GLOBL"] = amd64.AGLOBL
+	pseudos["PCDATA"] = amd64.APCDATA
+	pseudos["TEXT"] = amd64.ATEXT
+
+	return &Arch{
+		LinkArch:       &amd64.Linkamd64,
+		D_INDIR:        amd64.D_INDIR,
+		D_CONST2:       amd64.D_NONE,
+		SP:             amd64.D_SP,
+		noAddr:         noAddr,
+		instructions:   instructions,
+		anames:         amd64.Anames6,
+		jumps:          x86Jumps(instructions),
+		registers:      registers,
+		pseudos:        pseudos,
+		shapes:         x86Shapes(instructions),
+		defaultShapes:  x86DefaultShapes,
+		regClasses:     x86RegisterClasses(registers),
+		classes:        x86Classes(instructions),
+		defaultClasses: operandClasses{slotTo: classRegisters | classMem},
+	}
+}
+
+var x86DefaultShapes = []shape{
+	{},
+	{slotFrom},
+	{slotFrom, slotTo},
+}
+
+// x86Shapes returns the operand shapes of the x86 instructions that differ from x86DefaultShapes.
+// It covers both 386 and amd64; names the architecture lacks are skipped.
+func x86Shapes(instructions map[string]int) map[int][]shape {
+	shapes := make(map[int][]shape)
+	// These instructions write their single operand to prog.To.
+	setShape(shapes, instructions, shape{slotTo},
+		"BSWAPL", "BSWAPQ", "CMPXCHG8B",
+		"DECB", "DECL", "DECQ", "DECW",
+		"INCB", "INCL", "INCQ", "INCW",
+		"NEGB", "NEGL", "NEGQ", "NEGW",
+		"NOTB", "NOTL", "NOTQ", "NOTW",
+		"POPL", "POPQ", "POPW",
+		"SETCC", "SETCS", "SETEQ", "SETGE", "SETGT", "SETHI", "SETLE", "SETLS",
+		"SETLT", "SETMI", "SETNE", "SETOC", "SETOS", "SETPC", "SETPL", "SETPS",
+		"FFREE", "FLDENV", "FSAVE", "FSTCW", "FSTENV", "FSTSW",
+		"FXSAVE", "FXSAVE64", "STMXCSR")
+	// CMPPS X1, X0, 4: the comparison predicate follows the registers and is stored in To.Offset.
+	setShape(shapes, instructions, shape{slotFrom, slotTo, slotToConst},
+		"CMPPD", "CMPPS", "CMPSD", "CMPSS")
+	// IMUL3Q $5, AX, BX: the immediate comes first and is stored in To.Offset.
+	setShape(shapes, instructions, shape{slotToImm, slotFrom, slotTo},
+		"AESKEYGENASSIST", "IMUL3Q", "PCLMULQDQ", "PEXTRW",
+		"PINSRD", "PINSRQ", "PINSRW",
+		"PSHUFD", "PSHUFHW", "PSHUFL", "PSHUFLW", "PSHUFW",
+		"SHUFPD", "SHUFPS")
+	// SHLQ $4, DX:AX and SHLQ $4, AX, DX: the double shifts take the register shifted in
+	// from From.Index, written either as the low half of a register pair or as a middle operand.
+	// From.Index cannot be avoided: an x86 Prog has no third operand, and liblink, like 6a,
+	// reads the second register of a double shift from there.
+	doubleShifts := []string{"SHLL", "SHLQ", "SHLW", "SHRL", "SHRQ", "SHRW"}
+	setShape(shapes, instructions, shape{slotFrom, slotToPair}, doubleShifts...)
+	setShape(shapes, instructions, shape{slotFrom, slotFromIndex, slotTo}, doubleShifts...)
+	// TODO: VEX shapes, such as VPADDD X1, X2, X3, with the middle source in slotFrom3.
+	// liblink has no AVX instructions yet, so VPADDD is an unrecognized instruction.
+	// TODO: Move the second register of a double shift out of From.Index once
+	// liblink reads it from somewhere else.
+	return shapes
+}
+
+// x86Classes returns the operand classes of the x86 instructions that differ from the default,
+// which allows any source and a register or memory destination.
+// It covers both 386 and amd64; names the architecture lacks are skipped.
+func x86Classes(instructions map[string]int) map[int]operandClasses {
+	classes := make(map[int]operandClasses)
+	imm16 := classImm8 | classImm16
+	imm32 := imm16 | classImm32
+	for _, size := range []struct {
+		suffix string
+		imm    class // Immediates allowed in the source.
+		movImm class // Immediates allowed in the source of MOV.
+	}{
+		{"B", classImm8, classImm8},
+		{"W", imm16, imm16},
+		{"L", imm32, imm32},
+		{"Q", imm32, classImm}, // Only MOVQ takes a 64-bit immediate.
+	} {
+		suffixed := func(names ...string) []string {
+			for i := range names {
+				names[i] += size.suffix
+			}
+			return names
+		}
+		setClasses(classes, instructions, operandClasses{
+			slotFrom: classRegisters | classMem | size.movImm | classAddr,
+			slotTo:   classRegisters | classMem,
+		}, suffixed("MOV")...)
+		setClasses(classes, instructions, operandClasses{
+			slotFrom: classReg | classMem | size.imm | classAddr,
+			slotTo:   classReg | classMem,
+		}, suffixed("ADC", "ADD", "AND", "OR", "SBB", "SUB", "TEST", "XOR")...)
+		// CMPQ AX, $0: either operand may be immediate or an address.
+		setClasses(classes, instructions, operandClasses{
+			slotFrom: classReg | classMem | size.imm | classAddr,
+			slotTo:   classReg | classMem | size.imm | classAddr,
+		}, suffixed("CMP")...)
+		// The shift count is an 8-bit immediate or CX.
+		setClasses(classes, instructions, operandClasses{
+			slotFrom: classReg | classImm8,
+			slotTo:   classReg | classMem,
+		}, suffixed("RCL", "RCR", "ROL", "ROR", "SAL", "SAR", "SHL", "SHR")...)
+		setClasses(classes, instructions, operandClasses{
+			slotFrom: classMem,
+			slotTo:   classReg,
+		}, suffixed("LEA")...)
+		setClasses(classes, instructions, operandClasses{
+			slotFrom: classReg | classMem | size.imm | classAddr,
+		}, suffixed("PUSH")...)
+	}
+	setClasses(classes, instructions, operandClasses{slotFrom: classImm8}, "INT")
+	return classes
+}
+
+// x86Jumps returns the set of x86 jump instructions: those whose names begin with J, plus CALL.
+func x86Jumps(instructions map[string]int) map[string]bool {
+	jumps := make(map[string]bool)
+	for s := range instructions {
+		if s[0] == 'J' || s == "CALL" {
+			jumps[s] = true
+		}
+	}
+	return jumps
+}
+
+func archArm() *Arch {
+	noAddr := liblink.Addr{
+		Typ:  arm.D_NONE,
+		Name: arm.D_NONE,
+		Reg:  arm.NREG,
+	}
+
+	registers := make(map[string]int)
+	// Create maps for easy lookup of instruction names etc.
+	// There is no Regstr table for ARM, so build the names here.
+	// The register values encode both the liblink type and the number; see riscRegister.
+	for i := 0; i < 16; i++ {
+		registers[fmt.Sprintf("R%d", i)] = riscRegister(arm.D_REG, i)
+		registers[fmt.Sprintf("F%d", i)] = riscRegister(arm.D_FREG, i)
+	}
+	registers["g"] = riscRegister(arm.D_REG, 10)
+	registers["CPSR"] = riscRegister(arm.D_PSR, 0)
+	registers["SPSR"] = riscRegister(arm.D_PSR, 1)
+	registers["FPSR"] = riscRegister(arm.D_FPCR, 0)
+	registers["FPCR"] = riscRegister(arm.D_FPCR, 1)
+	// Pseudo-registers.
+	registers["SB"] = rSB
+	registers["FP"] = rFP
+	registers["SP"] = rSP
+	registers["PC"] = rPC
+
+	instructions := make(map[string]int)
+	for i, s := range arm.Anames5 {
+		instructions[s] = i
+	}
+	// Annoying aliases.
+	instructions["JMP"] = arm.AB
+	instructions["CALL"] = arm.ABL
+
+	jumps := make(map[string]bool)
+	for _, s := range []string{
+		"B", "BL", "CALL", "JMP",
+		"BEQ", "BNE", "BCS", "BHS", "BCC", "BLO", "BMI", "BPL",
+		"BVS", "BVC", "BHI", "BLS", "BGE", "BLT", "BGT", "BLE",
+	} {
+		jumps[s] = true
+	}
+
+	pseudos := make(map[string]int) // TEXT, DATA etc.
+	pseudos["DATA"] = arm.ADATA
+	pseudos["FUNCDATA"] = arm.AFUNCDATA
+	pseudos["GLOBL"] = arm.AGLOBL
+	pseudos["PCDATA"] = arm.APCDATA
+	pseudos["TEXT"] = arm.ATEXT
+
+	shapes := make(map[int][]shape)
+	// These instructions write their single operand to prog.To.
+	setShape(shapes, instructions, shape{slotTo}, "SWI", "WORD")
+
+	classes := make(map[int]operandClasses)
+	setClasses(classes, instructions, operandClasses{slotTo: classImm | classAddr}, "SWI", "WORD")
+
+	return &Arch{
+		LinkArch:     &arm.Linkarm,
+		D_CONST2:     arm.D_CONST2,
+		SP:           riscRegister(arm.D_REG, arm.REGSP),
+		noAddr:       noAddr,
+		regNone:      arm.NREG,
+		instructions: instructions,
+		anames:       arm.Anames5,
+		jumps:        jumps,
+		registers:    registers,
+		pseudos:      pseudos,
+		shapes:       shapes,
+		defaultShapes: []shape{
+			{},
+			{slotFrom},
+			{slotFrom, slotTo},
+			// ADD R1, R2, R3: the middle operand is a register and is stored in Prog.Reg.
+			{slotFrom, slotReg, slotTo},
+			// MULA R1, R2, R3, R4: R1*R2+R3 -> R4; the last two are stored in To.
+			{slotFrom, slotReg, slotToReg, slotToReg2},
+		},
+		classes:        classes,
+		defaultClasses: operandClasses{slotTo: classRegisters | classMem | classRegList | classRegPair},
+	}
+}
+
+func archPPC64(linkArch *liblink.LinkArch) *Arch {
+	noAddr := liblink.Addr{
+		Typ:  ppc64.D_NONE,
+		Name: ppc64.D_NONE,
+		Reg:  ppc64.NREG,
+	}
+
+	registers := make(map[string]int)
+	// Create maps for easy lookup of instruction names etc.
+	// There is no Regstr table for ppc64, so build the names here.
+	// The register values encode both the liblink type and the number; see riscRegister.
+	for i := 0; i < 32; i++ {
+		registers[fmt.Sprintf("R%d", i)] = riscRegister(ppc64.D_REG, i)
+		registers[fmt.Sprintf("F%d", i)] = riscRegister(ppc64.D_FREG, i)
+	}
+	for i := 0; i < 8; i++ {
+		registers[fmt.Sprintf("CR%d", i)] = riscRegister(ppc64.D_CREG, i)
+	}
+	registers["g"] = riscRegister(ppc64.D_REG, 30)
+	registers["CR"] = riscRegister(ppc64.D_CREG, ppc64.NREG)
+	// The special-purpose registers carry their SPR number, which goes in Addr.Offset.
+	registers["XER"] = riscRegister(ppc64.D_SPR, ppc64.D_XER)
+	registers["LR"] = riscRegister(ppc64.D_SPR, ppc64.D_LR)
+	registers["CTR"] = riscRegister(ppc64.D_SPR, ppc64.D_CTR)
+	registers["MSR"] = riscRegister(ppc64.D_MSR, ppc64.NREG)
+	registers["FPSCR"] = riscRegister(ppc64.D_FPSCR, ppc64.NREG)
+	// Pseudo-registers.
+	registers["SB"] = rSB
+	registers["FP"] = rFP
+	registers["SP"] = rSP
+	registers["PC"] = rPC
+
+	instructions := make(map[string]int)
+	for i, s := range ppc64.Anames9 {
+		instructions[s] = i
+	}
+	// Annoying aliases.
+	instructions["JMP"] = ppc64.ABR
+	instructions["CALL"] = ppc64.ABL
+
+	jumps := make(map[string]bool)
+	for _, s := range []string{
+		"BR", "BL", "BC", "BCL", "CALL", "JMP",
+		"BEQ", "BNE", "BGE", "BGT", "BLE", "BLT", "BVC", "BVS",
+	} {
+		jumps[s] = true
+	}
+
+	pseudos := make(map[string]int) // TEXT, DATA etc.
+	pseudos["DATA"] = ppc64.ADATA
+	pseudos["FUNCDATA"] = ppc64.AFUNCDATA
+	pseudos["GLOBL"] = ppc64.AGLOBL
+	pseudos["PCDATA"] = ppc64.APCDATA
+	pseudos["TEXT"] = ppc64.ATEXT
+
+	shapes := make(map[int][]shape)
+	// These instructions write their single operand to prog.To.
+	setShape(shapes, instructions, shape{slotTo}, "MFCR", "WORD")
+
+	classes := make(map[int]operandClasses)
+	setClasses(classes, instructions, operandClasses{slotTo: classImm | classAddr}, "WORD")
+	// CMP R3, $4: the comparisons may take an immediate second operand.
+	setClasses(classes, instructions, operandClasses{slotTo: classRegisters | classImm}, "CMP", "CMPU", "CMPW", "CMPWU")
+
+	return &Arch{
+		LinkArch:     linkArch,
+		SP:           riscRegister(ppc64.D_REG, ppc64.REGSP),
+		noAddr:       noAddr,
+		regNone:      ppc64.NREG,
+		instructions: instructions,
+		anames:       ppc64.Anames9,
+		jumps:        jumps,
+		registers:    registers,
+		pseudos:      pseudos,
+		shapes:       shapes,
+		defaultShapes: []shape{
+			{},
+			{slotFrom},
+			{slotFrom, slotTo},
+			// ADD R1, R2, R3: the middle operand is a register and is stored in Prog.Reg.
+			{slotFrom, slotReg, slotTo},
+			// FMADD F1, F2, F3, F4 and RLWNM $sh, R1, $mask, R2: the third operand goes in From3.
+			{slotFrom, slotReg, slotFrom3, slotTo},
+		},
+		classes:        classes,
+		defaultClasses: operandClasses{slotTo: classRegisters | classMem},
+	}
+}
+
+// A slot is a place in a Prog that holds an operand.
+type slot int
+
+const (
+	slotFrom      slot = iota // Prog.From.
+	slotTo                    // Prog.To.
+	slotReg                   // Prog.Reg, which holds a register number on the RISC machines.
+	slotFrom3                 // Prog.From3.
+	slotToConst               // Prog.To.Offset, written as a bare constant.
+	slotToImm                 // Prog.To.Offset, written as an immediate $constant.
+	slotFromIndex             // Prog.From.Index, which holds a register.
+	slotToPair                // A register pair hi:lo; hi goes in Prog.To and lo in Prog.From.Index.
+	slotToReg                 // Prog.To.Reg, the first register of an ARM D_REGREG2 destination.
+	slotToReg2                // Prog.To.Offset, the second register of an ARM D_REGREG2 destination.
+)
+
+// A shape lists the slots of an instruction's operands, in the order they are written.
+type shape []slot
+
+// setShape adds the shape s to the named instructions. Names not in instructions are skipped.
+func setShape(shapes map[int][]shape, instructions map[string]int, s shape, names ...string) {
+	for _, name := range names {
+		if op, ok := instructions[name]; ok {
+			shapes[op] = append(shapes[op], s)
+		}
+	}
+}
+
+// setClasses gives the named instructions the operand classes c. Names not in instructions are skipped.
+func setClasses(classes map[int]operandClasses, instructions map[string]int, c operandClasses, names ...string) {
+	for _, name := range names {
+		if op, ok := instructions[name]; ok {
+			classes[op] = c
+		}
+	}
+}
+
+// shape returns the shape of the instruction op with n operands, or nil if it cannot have n operands.
+func (a *Arch) shape(op, n int) shape {
+	for _, s := range a.shapes[op] {
+		if len(s) == n {
+			return s
+		}
+	}
+	if n < len(a.defaultShapes) {
+		return a.defaultShapes[n]
+	}
+	return nil
+}
+
+// operandShapes returns all the shapes the instruction op accepts, those particular to it first.
+func (a *Arch) operandShapes(op int) []shape {
+	special := a.shapes[op]
+	shapes := append([]shape(nil), special...)
+Defaults:
+	for n, s := range a.defaultShapes {
+		if s == nil {
+			continue
+		}
+		for _, t := range special {
+			if len(t) == n {
+				continue Defaults
+			}
+		}
+		shapes = append(shapes, s)
+	}
+	return shapes
+}
+
+// riscRegister encodes a register for the RISC machines as a value in
+// Arch.registers. There liblink keeps the register's type (D_REG, D_FREG, ...)
+// in Addr.Typ and its number in Addr.Reg, so the value must carry both.
+// The pseudo-registers (rSB etc.) are negative and never encoded this way.
+func riscRegister(typ, num int) int {
+	return typ<<16 | num
+}
+
+// riscRegisterType decodes a value made by riscRegister.
+func riscRegisterType(r int) (typ, num int) {
+	return r >> 16, r & 0xFFFF
+}
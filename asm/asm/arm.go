@@ -0,0 +1,289 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file encapsulates some of the odd characteristics of the ARM
+// instruction set, to minimize its interaction with the core of the
+// assembler.
+
+package asm
+
+import (
+	"strings"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rsc/c2go/liblink/arm"
+)
+
+// ARM condition codes, as stored in the low bits of Prog.Scond.
+const (
+	armEQ = iota
+	armNE
+	armCS
+	armCC
+	armMI
+	armPL
+	armVS
+	armVC
+	armHI
+	armLS
+	armGE
+	armLT
+	armGT
+	armLE
+	armAL // The default: always.
+)
+
+var armConditions = map[string]int{
+	"EQ": armEQ,
+	"NE": armNE,
+	"CS": armCS,
+	"HS": armCS,
+	"CC": armCC,
+	"LO": armCC,
+	"MI": armMI,
+	"PL": armPL,
+	"VS": armVS,
+	"VC": armVC,
+	"HI": armHI,
+	"LS": armLS,
+	"GE": armGE,
+	"LT": armLT,
+	"GT": armGT,
+	"LE": armLE,
+	"AL": armAL,
+}
+
+// armSuffixes holds the bits set in Prog.Scond by the other instruction suffixes.
+var armSuffixes = map[string]int{
+	"S":  arm.C_SBIT,
+	"P":  arm.C_PBIT,
+	"W":  arm.C_WBIT,
+	"U":  arm.C_UBIT,
+	"F":  arm.C_FBIT,
+	"IA": arm.C_UBIT,
+	"IB": arm.C_PBIT | arm.C_UBIT,
+	"DA": 0,
+	"DB": arm.C_PBIT,
+}
+
+// armConditionCode returns the Scond value for an ARM instruction with the given
+// suffixes, such as ".EQ" or ".NE.S". At most one of the suffixes may be a condition.
+func (p *Parser) armConditionCode(word, cond string) int {
+	scond := armAL
+	haveCond := false
+	for _, s := range strings.Split(cond, ".") {
+		if s == "" {
+			continue
+		}
+		if c, ok := armConditions[s]; ok {
+			if haveCond {
+				p.errorf("multiple conditions in %s%s", word, cond)
+			}
+			haveCond = true
+			scond = scond&^arm.C_SCOND | c
+			continue
+		}
+		bits, ok := armSuffixes[s]
+		if !ok {
+			p.errorf("unrecognized suffix .%s in %s%s", s, word, cond)
+		}
+		scond |= bits
+	}
+	return scond
+}
+
+// armRegister parses an ARM general register, such as R3, and returns its number.
+func (p *Parser) armRegister() int {
+	tok := p.next()
+	r, present := p.arch.registers[tok.text]
+	if tok.Token != scanner.Ident || !present || r < 0 {
+		p.errorf("expected register, found %s", tok.text)
+		return 0
+	}
+	typ, num := riscRegisterType(r)
+	if typ != arm.D_REG {
+		p.errorf("expected general register, found %s", tok.text)
+	}
+	return num
+}
+
+// armRegisterNumber returns the number of the register in a, which must be a
+// plain ARM general register operand.
+func (p *Parser) armRegisterNumber(a *Addr) int {
+	if !a.is(addrRegister) || a.register < 0 {
+		p.errorf("expected register operand")
+		return 0
+	}
+	typ, num := riscRegisterType(a.register)
+	if typ != arm.D_REG {
+		p.errorf("expected general register operand")
+	}
+	return num
+}
+
+// registerList parses an ARM register list, such as [R1,R3-R5], into a bit mask.
+// Each element is a register or a range of registers. The opening bracket is known to be there.
+func (p *Parser) registerList(a *Addr) {
+	if p.arch.Thechar != '5' {
+		p.errorf("register list not supported on %s", p.arch.Name)
+		p.next()
+		return
+	}
+	p.next() // Skip '['.
+	var bits uint16
+	for {
+		lo := p.armRegister()
+		hi := lo
+		if p.peek() == '-' {
+			p.next()
+			hi = p.armRegister()
+		}
+		if hi < lo {
+			p.errorf("bad register range R%d-R%d", lo, hi)
+		}
+		for r := lo; r <= hi; r++ {
+			if bits&(1<<uint(r)) != 0 {
+				p.errorf("register R%d already in list", r)
+			}
+			bits |= 1 << uint(r)
+		}
+		tok := p.next()
+		if tok.Token == ']' {
+			break
+		}
+		if tok.Token != ',' {
+			p.errorf("expected ',' or ']' in register list, found %s", tok.text)
+			return
+		}
+	}
+	a.hasRegList = true
+	a.regList = bits
+}
+
+// registerShift parses the shift in an ARM shifted register operand, such as R1<<2
+// or R1->R2. The register itself has already been parsed into a.
+// The encoding is liblink's: the register in the low 4 bits, the shift type in
+// bits 5-6, and then either the count in bits 7-11 or, with bit 4 set, the
+// register holding the count in bits 8-11.
+func (p *Parser) registerShift(a *Addr) {
+	if p.arch.Thechar != '5' {
+		p.errorf("shifted register not supported on %s", p.arch.Name)
+		return
+	}
+	r := p.armRegisterNumber(a)
+	var typ int64
+	switch p.next().Token {
+	case LSH:
+		typ = 0
+	case RSH:
+		typ = 1
+	case ARR:
+		typ = 2
+	case ROT:
+		typ = 3
+	}
+	shift := int64(r&15) | typ<<5
+	if p.peek() == scanner.Ident {
+		count := p.armRegister()
+		shift |= int64(count&15)<<8 | 1<<4
+	} else {
+		count := p.expr()
+		if count > 31 {
+			p.errorf("shift count %d out of range", count)
+		}
+		shift |= int64(count&31) << 7
+	}
+	a.hasShift = true
+	a.shift = shift
+}
+
+// registerPair parses an ARM register pair, such as (R1, R2), as used by MULL.
+// The opening paren is known to be there.
+func (p *Parser) registerPair(a *Addr) {
+	if p.arch.Thechar != '5' {
+		p.errorf("register pair not supported on %s", p.arch.Name)
+		return
+	}
+	p.next() // Skip '('.
+	a.hasRegister = true
+	a.register = riscRegister(arm.D_REG, p.armRegister())
+	p.get(',')
+	a.hasRegister2 = true
+	a.register2 = riscRegister(arm.D_REG, p.armRegister())
+	p.get(')')
+}
+
+// armAddrToAddr is the ARM version of addrToAddr. Unlike x86, ARM keeps the
+// register number in Addr.Reg and the symbol kind in Addr.Name, and memory
+// references have type D_OREG.
+func (p *Parser) armAddrToAddr(a *Addr) liblink.Addr {
+	out := p.arch.noAddr
+	switch {
+	case a.has(addrRegList):
+		// [R0-R3] is encoded as a constant bit mask.
+		out.Typ = arm.D_CONST
+		out.Offset = int64(a.regList)
+	case a.has(addrShift):
+		out.Typ = arm.D_SHIFT
+		out.Offset = a.shift
+	case a.has(addrSymbol):
+		out = p.symbolAddr(a, a.symbol)
+		if a.isImmediateAddress {
+			// $sym(SB) is the address itself.
+			out.Typ = arm.D_CONST
+		}
+	case a.has(addrRegister2):
+		// (R1, R2).
+		_, out.Reg = riscRegisterType(a.register)
+		_, r2 := riscRegisterType(a.register2)
+		out.Typ = arm.D_REGREG
+		out.Offset = int64(r2)
+	case a.has(addrRegister):
+		out.Offset = a.offset
+		switch a.register {
+		case rSB, rFP:
+			out.Typ = arm.D_OREG
+			out.Name = p.symbolType(a)
+		case rSP:
+			if a.isIndirect {
+				out.Typ = arm.D_OREG
+				out.Name = arm.D_AUTO
+			} else {
+				// Bare SP is the hardware register.
+				out.Typ = arm.D_REG
+				out.Reg = arm.REGSP
+			}
+		case rPC:
+			p.errorf("illegal use of PC")
+		default:
+			out.Typ, out.Reg = riscRegisterType(a.register)
+			if a.isIndirect {
+				if out.Typ != arm.D_REG {
+					p.errorf("indirection through non-general register")
+				}
+				out.Typ = arm.D_OREG
+			}
+		}
+	case a.has(addrFloat):
+		out.Typ = arm.D_FCONST
+		out.U.Dval = a.float
+	case a.has(addrString):
+		out.Typ = arm.D_SCONST
+		out.U.Sval = a.string
+	case a.has(addrOffset):
+		out.Offset = a.offset
+		if a.isImmediateConstant {
+			out.Typ = arm.D_CONST
+		} else {
+			// Absolute memory address.
+			out.Typ = arm.D_OREG
+		}
+	}
+	if a.isImmediateAddress && out.Typ == arm.D_OREG {
+		// $8(R1) and $8(SP) are the address itself.
+		out.Typ = arm.D_CONST
+	}
+	return out
+}
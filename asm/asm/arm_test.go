@@ -0,0 +1,141 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"strings"
+	"testing"
+
+	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rsc/c2go/liblink/arm"
+)
+
+func newTestParser(arch *Arch) *Parser {
+	p := NewParser(liblink.Linknew(arch.LinkArch), arch, NewSlice("test", 1, 0, nil), &Diagnostics{})
+	p.lineNum = 1
+	return p
+}
+
+var armOperandTests = []struct {
+	input  string
+	typ    int
+	reg    int
+	name   int
+	offset int64
+}{
+	{"R1", arm.D_REG, 1, arm.D_NONE, 0},
+	{"g", arm.D_REG, 10, arm.D_NONE, 0},
+	{"F2", arm.D_FREG, 2, arm.D_NONE, 0},
+	{"CPSR", arm.D_PSR, 0, arm.D_NONE, 0},
+	{"FPCR", arm.D_FPCR, 1, arm.D_NONE, 0},
+	{"(R1)", arm.D_OREG, 1, arm.D_NONE, 0},
+	{"-4(R13)", arm.D_OREG, 13, arm.D_NONE, -4},
+	{"$4", arm.D_CONST, arm.NREG, arm.D_NONE, 4},
+	{"[R0-R3]", arm.D_CONST, arm.NREG, arm.D_NONE, 0xF},
+	{"[R0,R2-R3,R5]", arm.D_CONST, arm.NREG, arm.D_NONE, 0x2D},
+	{"R1<<2", arm.D_SHIFT, arm.NREG, arm.D_NONE, 1 | 0<<5 | 2<<7},
+	{"R1>>R2", arm.D_SHIFT, arm.NREG, arm.D_NONE, 1 | 1<<5 | 2<<8 | 1<<4},
+	{"R3->4", arm.D_SHIFT, arm.NREG, arm.D_NONE, 3 | 2<<5 | 4<<7},
+	{"R3@>1", arm.D_SHIFT, arm.NREG, arm.D_NONE, 3 | 3<<5 | 1<<7},
+	{"(R1, R2)", arm.D_REGREG, 1, arm.D_NONE, 2},
+	{"x+4(FP)", arm.D_OREG, arm.NREG, arm.D_PARAM, 4},
+	{"y-8(SP)", arm.D_OREG, arm.NREG, arm.D_AUTO, -8},
+	{"foo<>(SB)", arm.D_OREG, arm.NREG, arm.D_STATIC, 0},
+	{"$foo(SB)", arm.D_CONST, arm.NREG, arm.D_EXTERN, 0},
+	{"SP", arm.D_REG, arm.REGSP, arm.D_NONE, 0},
+	{"8(SP)", arm.D_OREG, arm.NREG, arm.D_AUTO, 8},
+	{"$8(SP)", arm.D_CONST, arm.NREG, arm.D_AUTO, 8},
+	{"$y-8(SP)", arm.D_CONST, arm.NREG, arm.D_AUTO, -8},
+	{"$8(R1)", arm.D_CONST, 1, arm.D_NONE, 8},
+}
+
+func TestArmOperand(t *testing.T) {
+	arch := archArm()
+	for _, test := range armOperandTests {
+		p := newTestParser(arch)
+		addr := p.address(tokenize(test.input))
+		out := p.addrToAddr(&addr)
+		if p.diag.ErrorCount() != 0 {
+			t.Errorf("%s: unexpected error", test.input)
+			continue
+		}
+		if out.Typ != test.typ || out.Reg != test.reg || out.Name != test.name || out.Offset != test.offset {
+			t.Errorf("%s: got typ=%d reg=%d name=%d offset=%#x; want typ=%d reg=%d name=%d offset=%#x",
+				test.input, out.Typ, out.Reg, out.Name, out.Offset, test.typ, test.reg, test.name, test.offset)
+		}
+	}
+}
+
+var armBadOperandTests = []string{
+	"[R0-R3",
+	"[R3-R0]",
+	"[R0,R0]",
+	"[F0]",
+	"R1<<32",
+	"F1<<2",
+}
+
+func TestArmBadOperand(t *testing.T) {
+	arch := archArm()
+	for _, input := range armBadOperandTests {
+		p := newTestParser(arch)
+		addr := p.address(tokenize(input))
+		p.addrToAddr(&addr)
+		if p.diag.ErrorCount() == 0 {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+var armConditionTests = []struct {
+	suffix string
+	scond  int
+	ok     bool
+}{
+	{"", armAL, true},
+	{".EQ", armEQ, true},
+	{".HS", armCS, true},
+	{".S", armAL | arm.C_SBIT, true},
+	{".NE.S", armNE | arm.C_SBIT, true},
+	{".IA.W", armAL | arm.C_UBIT | arm.C_WBIT, true},
+	{".EQ.NE", 0, false},
+	{".XX", 0, false},
+}
+
+func TestArmConditionCode(t *testing.T) {
+	arch := archArm()
+	for _, test := range armConditionTests {
+		p := newTestParser(arch)
+		scond := p.armConditionCode("MOVW", test.suffix)
+		if ok := p.diag.ErrorCount() == 0; ok != test.ok {
+			t.Errorf("MOVW%s: ok=%t; want %t", test.suffix, ok, test.ok)
+			continue
+		}
+		if test.ok && scond != test.scond {
+			t.Errorf("MOVW%s: scond=%#x; want %#x", test.suffix, scond, test.scond)
+		}
+	}
+}
+
+func TestArmCorpus(t *testing.T) {
+	testGolden(t, "arm", "testdata/arm.s")
+}
+
+// Each of these has an operand of a class its instruction does not accept.
+var armBadClassTests = []string{
+	"MOVW R1, $2",
+	"SWI R1",
+	"MOVW (R1), (R2)",
+	"ADD $1, $2",
+}
+
+func TestArmBadClass(t *testing.T) {
+	for _, input := range armBadClassTests {
+		src := "TEXT foo(SB), 0, $0\n" + input + "\n"
+		if obj, _ := Assemble("arm", "x.s", strings.NewReader(src), Options{}); obj != nil {
+			t.Errorf("%s: assembled without error", input)
+		}
+	}
+}
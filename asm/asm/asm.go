@@ -0,0 +1,828 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+	"strings"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rsc/c2go/liblink/arm"
+)
+
+type Addr struct {
+	isStatic            bool    // symbol<>
+	isImmediateConstant bool    // $3
+	isImmediateAddress  bool    // $main·main(SB)
+	isIndirect          bool    // (R1)
+	hasRegister         bool    // register is set
+	hasRegister2        bool    // register2 is set
+	hasFloat            bool    // float is set
+	hasOffset           bool    // offset is set
+	hasString           bool    // string is set
+	hasRegList          bool    // regList is set
+	hasShift            bool    // shift is set
+	symbol              string  // "main·main"
+	register            int     // R1
+	register2           int     // R1 in R0:R1
+	offset              int64   // 3
+	float               float64 // 1.0e2 (floating constant)
+	string              string  // "hi" (string constant)
+	index               int     // R1 in (R1*8)
+	scale               int8    // 8 in (R1*8)
+	regList             uint16  // [R0-R3] on ARM, as a bit mask
+	shift               int64   // R1<<2 on ARM, as encoded by liblink
+
+	at LexToken // The first token of the operand, where diagnostics about it point.
+}
+
+const (
+	// isStatic does not appear here; is and has methods ignore it.
+	addrImmediateConstant = 1 << iota
+	addrImmediateAddress
+	addrIndirect
+	addrSymbol
+	addrRegister
+	addrRegister2
+	addrOffset
+	addrFloat
+	addrString
+	addrIndex
+	addrScale
+	addrRegList
+	addrShift
+)
+
+// has reports whether the address has any of the specified elements.
+// Indirect and immediate are not checked.
+func (a *Addr) has(mask int) bool {
+	if mask&addrSymbol != 0 && a.symbol != "" {
+		return true
+	}
+	if mask&addrRegister != 0 && a.hasRegister {
+		return true
+	}
+	if mask&addrRegister2 != 0 && a.hasRegister2 {
+		return true
+	}
+	if mask&addrOffset != 0 && a.hasOffset {
+		return true
+	}
+	if mask&addrFloat != 0 && a.hasFloat {
+		return true
+	}
+	if mask&addrString != 0 && a.hasString {
+		return true
+	}
+	if mask&addrIndex != 0 && a.index != 0 {
+		return true
+	}
+	if mask&addrScale != 0 && a.scale != 0 {
+		return true
+	}
+	if mask&addrRegList != 0 && a.hasRegList {
+		return true
+	}
+	if mask&addrShift != 0 && a.hasShift {
+		return true
+	}
+	return false
+}
+
+// has reports whether the address has exactly the specified elements.
+// Indirect and immediate are checked.
+func (a *Addr) is(mask int) bool {
+	if (mask&addrImmediateConstant == 0) != !a.isImmediateConstant {
+		return false
+	}
+	if (mask&addrImmediateAddress == 0) != !a.isImmediateAddress {
+		return false
+	}
+	if (mask&addrIndirect == 0) != !a.isIndirect {
+		return false
+	}
+	if (mask&addrSymbol == 0) != (a.symbol == "") {
+		return false
+	}
+	if (mask&addrRegister == 0) != !a.hasRegister {
+		return false
+	}
+	if (mask&addrRegister2 == 0) != !a.hasRegister2 {
+		return false
+	}
+	if (mask&addrOffset == 0) != !a.hasOffset {
+		// $0 has the immediate bit but value 0.
+		return false
+	}
+	if (mask&addrFloat == 0) != !a.hasFloat {
+		return false
+	}
+	if (mask&addrString == 0) != !a.hasString {
+		return false
+	}
+	if (mask&addrIndex == 0) != (a.index == 0) {
+		return false
+	}
+	if (mask&addrScale == 0) != (a.scale == 0) {
+		return false
+	}
+	if (mask&addrRegList == 0) != !a.hasRegList {
+		return false
+	}
+	if (mask&addrShift == 0) != !a.hasShift {
+		return false
+	}
+	return true
+}
+
+// symbolType returns the extern/static etc. type appropriate for the symbol.
+func (p *Parser) symbolType(a *Addr) int {
+	switch a.register {
+	case rFP:
+		return p.arch.D_PARAM
+	case rSP:
+		return p.arch.D_AUTO
+	case rSB:
+		p.symbol(a)
+		if a.isStatic {
+			return p.arch.D_STATIC
+		}
+		return p.arch.D_EXTERN
+	}
+	p.errorf("invalid register for symbol %s", a.symbol)
+	return 0
+}
+
+// linkName returns the name liblink knows the symbol by. The source writes
+// the package separator as a middle dot, as in runtime·memmove; the object uses a period.
+func linkName(symbol string) string {
+	return strings.Replace(symbol, "·", ".", -1)
+}
+
+// symbolAddr returns the liblink encoding of a reference to the named symbol,
+// as in foo+4(SB) or x+8(FP). On x86 the symbol kind is the address type;
+// on the RISC machines the type is D_OREG and the kind goes in Name.
+func (p *Parser) symbolAddr(a *Addr, name string) liblink.Addr {
+	out := p.arch.noAddr
+	switch p.arch.Thechar {
+	case '5', '9':
+		out.Typ = p.arch.D_OREG
+		out.Name = p.symbolType(a)
+	default:
+		out.Typ = p.symbolType(a)
+	}
+	out.Sym = liblink.Linklookup(p.linkCtxt, name, 0)
+	out.Offset = a.offset
+	return out
+}
+
+// setFlag stores the flag operand of TEXT and GLOBL, or the size operand of DATA.
+// On x86 it goes in From.Scale; on the RISC machines, in the Prog's register field.
+func (p *Parser) setFlag(prog *liblink.Prog, flag int8) {
+	switch p.arch.Thechar {
+	case '5', '9':
+		prog.Reg = int(flag)
+	default:
+		prog.From.Scale = flag
+	}
+}
+
+// newProg returns a Prog for op at the current line, with all its operands empty.
+func (p *Parser) newProg(op int) *liblink.Prog {
+	return &liblink.Prog{
+		Ctxt:   p.linkCtxt,
+		As:     op,
+		Lineno: p.lineNum,
+		Reg:    p.arch.regNone,
+		From:   p.arch.noAddr,
+		From3:  p.arch.noAddr,
+		To:     p.arch.noAddr,
+	}
+}
+
+// regNumber returns the number of the register in a, which must be a plain
+// register operand, for storing in Prog.Reg on the RISC machines.
+func (p *Parser) regNumber(a *Addr) int {
+	if !a.is(addrRegister) || a.register < 0 {
+		p.errorf("expected register operand")
+		return 0
+	}
+	_, num := riscRegisterType(a.register)
+	return num
+}
+
+func (p *Parser) addrToAddr(a *Addr) liblink.Addr {
+	switch p.arch.Thechar {
+	case '5':
+		return p.armAddrToAddr(a)
+	case '9':
+		return p.ppc64AddrToAddr(a)
+	}
+	out := p.arch.noAddr
+	if a.has(addrSymbol) {
+		// How to encode the symbols:
+		// syntax = Typ,Index
+		// $a(SB) = ADDR,EXTERN
+		// $a<>(SB) = ADDR,STATIC
+		// a(SB) = EXTERN,NONE
+		// a<>(SB) = STATIC,NONE
+		// $x-8(SP) = ADDR,AUTO
+		// $x+8(FP) = ADDR,PARAM
+		// The call to symbolType does the first column for the non-immediate forms;
+		// we need to fix up Index here.
+		out.Typ = p.symbolType(a)
+		out.Sym = liblink.Linklookup(p.linkCtxt, linkName(a.symbol), 0)
+		if a.isImmediateAddress {
+			// Index field says what kind of symbol it is.
+			out.Index = out.Typ
+			out.Typ = p.arch.D_ADDR
+		}
+	} else if a.has(addrRegister) {
+		// SP is both a pseudo-register and the hardware register:
+		// x-4(SP) = D_AUTO with sym=x, handled above as a symbol
+		// SP = D_SP
+		// 4(SP) = 4(D_SP); checkSP has diagnosed a negative offset
+		out.Typ = a.register
+		if a.register == rSP {
+			out.Typ = p.arch.SP
+		}
+		if a.isIndirect {
+			out.Typ += p.arch.D_INDIR
+		}
+		// a.register2 is the low half of a register pair; see slotToPair.
+	}
+	if a.has(addrIndex) {
+		out.Index = a.index
+	}
+	if a.has(addrScale) {
+		out.Scale = a.scale
+	}
+	if a.has(addrOffset) {
+		out.Offset = a.offset
+		if a.is(addrOffset) {
+			// Absolute address: RHS of MOVL $0xf1, 0xf1.
+			out.Typ = p.arch.D_INDIR + p.arch.D_NONE
+		} else if a.isImmediateConstant && out.Typ == p.arch.D_NONE {
+			out.Typ = p.arch.D_CONST
+		}
+	}
+	if a.has(addrFloat) {
+		out.U.Dval = a.float
+		out.Typ = p.arch.D_FCONST
+	}
+	if a.has(addrString) {
+		out.U.Sval = a.string
+		out.Typ = p.arch.D_SCONST
+	}
+	// HACK TODO
+	if a.isIndirect && !a.has(addrRegister) && a.has(addrIndex) {
+		// LHS of LEAQ	0(BX*8), CX
+		out.Typ = p.arch.D_INDIR + p.arch.D_NONE
+	}
+	if a.isImmediateAddress {
+		if a.has(addrIndex) {
+			// Index holds the kind of address, so there is nowhere to put the index register.
+			p.errorf("cannot take the address of an indexed operand")
+		}
+		if !a.has(addrSymbol) {
+			// $8(SP) = ADDR,INDIR+SP
+			out.Index = out.Typ
+			out.Typ = p.arch.D_ADDR
+		}
+	}
+	return out
+}
+
+func (p *Parser) link(prog *liblink.Prog, doLabel bool) {
+	if p.firstProg == nil {
+		p.firstProg = prog
+	} else {
+		p.lastProg.Link = prog
+	}
+	p.lastProg = prog
+	if doLabel {
+		if p.funcName == "" {
+			p.errorf("instruction outside of function")
+		}
+		p.pc++
+		for _, label := range p.pendingLabels {
+			if p.labels[label] != nil {
+				p.errorf("label %q multiply defined", label)
+			}
+			p.labels[label] = prog
+			p.labelFuncs[label] = p.funcName
+		}
+		p.pendingLabels = p.pendingLabels[0:0]
+	}
+	prog.Pc = int64(p.pc)
+	if p.arch.Thechar == '5' {
+		// Every ARM instruction has a condition, by default "always".
+		prog.Scond = p.scond
+	}
+	p.trace.printf(TraceLink, p.lex.FileName(), p.lineNum, "%v", prog)
+}
+
+// asmText assembles a TEXT pseudo-op.
+// TEXT runtime·sigtramp(SB),4,$0-0
+func (p *Parser) asmText(word string, operands [][]LexToken) {
+	if len(operands) != 3 {
+		p.errorf("expect three operands for TEXT")
+		return
+	}
+
+	// Operand 0 is the symbol name in the form foo(SB).
+	// That means symbol plus indirect on SB and no offset.
+	nameAddr := p.address(operands[0])
+	if !nameAddr.is(addrSymbol|addrRegister|addrIndirect) || nameAddr.register != rSB {
+		p.errorf("TEXT symbol %q must be an offset from SB", nameAddr.symbol)
+	}
+	name := linkName(nameAddr.symbol)
+
+	// Operand 1 is the text flag, a literal integer.
+	flagAddr := p.address(operands[1])
+	if !flagAddr.is(addrOffset) {
+		p.errorf("TEXT flag for %s must be an integer", name)
+	}
+	flag := int8(flagAddr.offset)
+
+	// Operand 2 is the frame and arg size.
+	// Bizarre syntax: $a-b is two words, not subtraction.
+	// We might even see $-b, which means $0-b. Ugly.
+	// Assume if it has this syntax that b is a plain constant.
+	// Not clear we can do better, but it doesn't matter.
+	op := operands[2]
+	n := len(op)
+	var locals int64
+	argSizeKnown := false
+	if n >= 2 && op[n-2].Token == '-' && op[n-1].Token == scanner.Int {
+		p.start(op[n-1:])
+		locals = int64(p.expr())
+		argSizeKnown = true
+		op = op[:n-2]
+	}
+	args := int64(0)
+	if len(op) == 1 && op[0].Token == '$' {
+		// Special case for $-8.
+		// Done; args is zero.
+	} else {
+		argsAddr := p.address(op)
+		if !argsAddr.is(addrImmediateConstant | addrOffset) {
+			p.errorf("TEXT frame size for %s must be an immediate constant", name)
+		}
+		args = argsAddr.offset
+	}
+
+	p.endFunction()
+	p.defineText(&nameAddr, flag, args)
+
+	// Remember the argument size to check references to the arguments.
+	p.funcName = name
+	p.argSize = -1
+	if argSizeKnown {
+		p.argSize = locals
+	}
+
+	prog := p.newProg(p.arch.ATEXT)
+	prog.From = p.symbolAddr(&nameAddr, name)
+	p.setFlag(prog, flag)
+	// Encoding of arg and locals depends on architecture.
+	switch p.arch.Thechar {
+	case '6':
+		prog.To.Typ = p.arch.D_CONST
+		prog.To.Offset = (locals << 32) | args
+	case '5', '8':
+		prog.To.Typ = p.arch.D_CONST2
+		prog.To.Offset = args
+		prog.To.Offset2 = int(locals)
+	case '9':
+		// Like amd64, but the frame size may be negative ($-8), so mask it.
+		prog.To.Typ = p.arch.D_CONST
+		prog.To.Offset = (locals << 32) | (args & 0xffffffff)
+	default:
+		p.errorf("internal error: can't encode TEXT arg/frame")
+	}
+	p.link(prog, true)
+	p.text = p.newPatch(prog, "")
+	p.text.at = p.inst
+	p.argsMap = false
+}
+
+// asmData assembles a DATA pseudo-op.
+// DATA masks<>+0x00(SB)/4, $0x00000000
+func (p *Parser) asmData(word string, operands [][]LexToken) {
+	if len(operands) != 2 {
+		p.errorf("expect two operands for DATA")
+		return
+	}
+
+	// Operand 0 has the general form foo<>+0x04(SB)/4.
+	op := operands[0]
+	n := len(op)
+	if n < 3 || op[n-2].Token != '/' || op[n-1].Token != scanner.Int {
+		p.errorf("expect /size for DATA argument")
+		return
+	}
+	scale := p.scale(op[n-1].text)
+	op = op[:n-2]
+	nameAddr := p.address(op)
+	ok := nameAddr.is(addrSymbol|addrRegister|addrIndirect) || nameAddr.is(addrSymbol|addrRegister|addrIndirect|addrOffset)
+	if !ok || nameAddr.register != rSB {
+		p.errorf("DATA symbol %q must be an offset from SB", nameAddr.symbol)
+	}
+	name := linkName(nameAddr.symbol)
+
+	// Operand 1 is an immediate constant or address.
+	valueAddr := p.address(operands[1])
+	if !valueAddr.isImmediateConstant && !valueAddr.isImmediateAddress {
+		p.errorf("DATA value must be an immediate constant or address")
+	}
+
+	// The addresses must not overlap. Easiest test: require monotonicity.
+	if lastAddr, ok := p.dataAddr[name]; ok && nameAddr.offset < lastAddr {
+		p.errorf("overlapping DATA entry for %s", nameAddr.symbol)
+	}
+	p.dataAddr[name] = nameAddr.offset + int64(scale)
+	p.recordData(&nameAddr, int(scale), &valueAddr)
+
+	prog := p.newProg(p.arch.ADATA)
+	prog.From = p.symbolAddr(&nameAddr, name)
+	p.setFlag(prog, scale)
+	prog.To = p.addrToAddr(&valueAddr)
+
+	p.link(prog, false)
+}
+
+// asmGlobl assembles a GLOBL pseudo-op.
+// GLOBL shifts<>(SB),8,$256
+// GLOBL shifts<>(SB),$256
+func (p *Parser) asmGlobl(word string, operands [][]LexToken) {
+	if len(operands) != 2 && len(operands) != 3 {
+		p.errorf("expect two or three operands for GLOBL")
+		return
+	}
+
+	// Operand 0 has the general form foo<>+0x04(SB).
+	nameAddr := p.address(operands[0])
+	if !nameAddr.is(addrSymbol|addrRegister|addrIndirect) || nameAddr.register != rSB {
+		p.errorf("GLOBL symbol %q must be an offset from SB", nameAddr.symbol)
+	}
+	name := linkName(nameAddr.symbol)
+
+	// If three operands, middle operand is a scale.
+	scale := int8(0)
+	op := operands[1]
+	if len(operands) == 3 {
+		scaleAddr := p.address(op)
+		if !scaleAddr.is(addrOffset) {
+			p.errorf("GLOBL scale must be a constant")
+		}
+		scale = int8(scaleAddr.offset)
+		op = operands[2]
+	}
+
+	// Final operand is an immediate constant.
+	sizeAddr := p.address(op)
+	if !sizeAddr.is(addrImmediateConstant | addrOffset) {
+		p.errorf("GLOBL size must be an immediate constant")
+	}
+	size := sizeAddr.offset
+	p.defineGlobl(&nameAddr, scale, size)
+
+	prog := p.newProg(p.arch.AGLOBL)
+	prog.From = p.symbolAddr(&nameAddr, name)
+	p.setFlag(prog, scale)
+	prog.To.Typ = p.arch.D_CONST
+	prog.To.Offset = size
+	p.link(prog, false)
+}
+
+// funcdataNames holds the constants from funcdata.h that PCDATA and FUNCDATA
+// accept by name, as in FUNCDATA $FUNCDATA_ArgsPointerMaps, args(SB).
+var funcdataNames = map[string]int64{
+	"PCDATA_StackMapIndex":       0,
+	"FUNCDATA_ArgsPointerMaps":   0,
+	"FUNCDATA_LocalsPointerMaps": 1,
+	"FUNCDATA_DeadValueMaps":     2,
+}
+
+// funcdataValue returns the value of the first operand of PCDATA or FUNCDATA:
+// an immediate constant or the name of one beginning with prefix.
+func (p *Parser) funcdataValue(word, prefix string, operand []LexToken) int64 {
+	addr := p.address(operand)
+	switch {
+	case addr.is(addrImmediateConstant | addrOffset):
+		return addr.offset
+	case addr.is(addrImmediateAddress|addrSymbol) && strings.HasPrefix(addr.symbol, prefix):
+		if value, ok := funcdataNames[addr.symbol]; ok {
+			return value
+		}
+		p.errorf("unknown %s constant %s", word, addr.symbol)
+	default:
+		p.errorf("%s value must be an immediate constant", word)
+	}
+	return 0
+}
+
+// asmPCData assembles a PCDATA pseudo-op.
+// PCDATA $2, $705
+func (p *Parser) asmPCData(word string, operands [][]LexToken) {
+	if len(operands) != 2 {
+		p.errorf("expect two operands for PCDATA")
+		return
+	}
+
+	// Operand 0 must be an immediate constant or a PCDATA_ name.
+	value0 := p.funcdataValue(word, "PCDATA_", operands[0])
+
+	// Operand 1 must be an immediate constant.
+	addr1 := p.address(operands[1])
+	if !addr1.is(addrImmediateConstant | addrOffset) {
+		p.errorf("PCDATA value must be an immediate constant")
+	}
+	value1 := addr1.offset
+
+	prog := p.newProg(p.arch.APCDATA)
+	prog.From.Typ = p.arch.D_CONST
+	prog.From.Offset = value0
+	prog.To.Typ = p.arch.D_CONST
+	prog.To.Offset = value1
+	p.link(prog, true)
+}
+
+// asmFuncData assembles a FUNCDATA pseudo-op.
+// FUNCDATA $1, funcdata<>+4(SB)
+func (p *Parser) asmFuncData(word string, operands [][]LexToken) {
+	if len(operands) != 2 {
+		p.errorf("expect two operands for FUNCDATA")
+		return
+	}
+
+	// Operand 0 must be an immediate constant or a FUNCDATA_ name.
+	value := p.funcdataValue(word, "FUNCDATA_", operands[0])
+	if value == funcdataNames["FUNCDATA_ArgsPointerMaps"] {
+		p.argsMap = true
+	}
+
+	// Operand 1 is a symbol name in the form foo(SB).
+	// That means symbol plus indirect on SB and no offset.
+	nameAddr := p.address(operands[1])
+	if !nameAddr.is(addrSymbol|addrRegister|addrIndirect) || nameAddr.register != rSB {
+		p.errorf("FUNCDATA symbol %q must be an offset from SB", nameAddr.symbol)
+	}
+	name := linkName(nameAddr.symbol)
+
+	prog := p.newProg(p.arch.AFUNCDATA)
+	prog.From.Typ = p.arch.D_CONST
+	prog.From.Offset = value
+	prog.To = p.symbolAddr(&nameAddr, name)
+	p.link(prog, true)
+}
+
+// asmJump assembles a jump instruction.
+// JMP	R1
+// JMP	exit
+// JMP	3(PC)
+func (p *Parser) asmJump(op int, addr []Addr) {
+	var target *Addr
+	prog := p.newProg(op)
+	switch len(addr) {
+	default:
+		p.errorf("jump must have one or two addresses")
+		return
+	case 1:
+		target = &addr[0]
+	case 2:
+		if p.arch.Thechar == '9' {
+			// BEQ CR1, label: the condition register goes in Prog.Reg.
+			prog.Reg = p.regNumber(&addr[0])
+		} else if !addr[0].is(0) {
+			p.errorf("two-address jump must have empty first address")
+		}
+		target = &addr[1]
+	case 3:
+		if p.arch.Thechar != '9' {
+			p.errorf("jump must have one or two addresses")
+			return
+		}
+		// BC 12, 2, label: the BO field is a constant in From and the BI field goes in Prog.Reg.
+		if !addr[0].is(addrOffset) || !addr[1].is(addrOffset) {
+			p.errorf("BO and BI fields of conditional branch must be constants")
+		}
+		prog.From.Typ = p.arch.D_CONST
+		prog.From.Offset = addr[0].offset
+		prog.Reg = int(addr[1].offset)
+		target = &addr[2]
+	}
+	switch {
+	case target.is(addrRegister):
+		// JMP R1
+		prog.To = p.addrToAddr(target)
+	case target.is(addrSymbol):
+		// JMP exit
+		targetProg := p.labels[target.symbol]
+		if targetProg == nil {
+			p.toPatch = append(p.toPatch, p.newPatch(prog, target.symbol))
+		} else {
+			p.branch(prog, targetProg)
+		}
+	case target.is(addrRegister | addrIndirect), target.is(addrRegister | addrIndirect | addrOffset):
+		// JMP 4(AX)
+		if target.register == rPC {
+			prog.To.Typ = p.arch.D_BRANCH
+			prog.To.Offset = p.pc + 1 + target.offset // +1 because p.pc is incremented in link, below.
+			p.pcJumps = append(p.pcJumps, p.newPatch(prog, ""))
+		} else {
+			prog.To = p.addrToAddr(target)
+		}
+	case target.is(addrSymbol | addrIndirect | addrRegister):
+		// JMP main·morestack(SB)
+		if target.register != rSB {
+			p.errorf("jmp to symbol must be SB-relative")
+		}
+		p.symbol(target)
+		prog.To.Typ = p.arch.D_BRANCH
+		prog.To.Sym = liblink.Linklookup(p.linkCtxt, linkName(target.symbol), 0)
+		prog.To.Offset = target.offset
+	default:
+		p.errorf("cannot assemble jump %+v", target)
+	}
+	p.link(prog, true)
+}
+
+// position returns the position of the instruction: file:line.
+func (patch *Patch) position() string {
+	return fmt.Sprintf("%s:%d", patch.file, patch.line)
+}
+
+// newPatch returns a Patch for the jump prog on the current line.
+func (p *Parser) newPatch(prog *liblink.Prog, label string) Patch {
+	return Patch{
+		prog:  prog,
+		label: label,
+		fn:    p.funcName,
+		file:  p.lex.FileName(),
+		line:  p.lineNum,
+		at:    p.at,
+	}
+}
+
+// endScope ends the scope of the current function's labels, which begins at its TEXT.
+// It resolves the jumps to labels defined since, sets aside those it cannot resolve,
+// and checks that jumps relative to the PC stay within the function.
+func (p *Parser) endScope() {
+	for _, patch := range p.toPatch {
+		if target := p.labels[patch.label]; target != nil {
+			p.branch(patch.prog, target)
+		} else {
+			p.unresolved = append(p.unresolved, patch)
+		}
+	}
+	if p.funcName != "" {
+		for _, patch := range p.pcJumps {
+			if target := patch.prog.To.Offset; target <= p.text.prog.Pc || target > p.pc {
+				p.reportAt(patch, Error, "jump to %d(PC) leaves function %s", target-patch.prog.Pc, patch.fn)
+			}
+		}
+	}
+	p.labels = make(map[string]*liblink.Prog)
+	p.toPatch = nil
+	p.pcJumps = nil
+}
+
+// endFunction finishes the current function, if any, at its end: the next TEXT or EOF.
+func (p *Parser) endFunction() {
+	p.endScope()
+	if p.funcName != "" && p.argSize > 0 && !p.argsMap {
+		p.addArgsMap()
+	}
+}
+
+// addArgsMap gives the current function, which has arguments, a pointer map for them
+// so the garbage collector can find the pointers among them. A function in the package
+// being assembled, ·f, gets the map the compiler writes for its Go declaration,
+// as GO_ARGS in funcdata.h does. For a function named in another package, pkg·f, there
+// may be no such declaration, so it gets a warning. A function with no package at all
+// cannot be declared in Go and has no map to refer to.
+func (p *Parser) addArgsMap() {
+	switch i := strings.Index(p.funcName, "."); {
+	case i < 0:
+		return
+	case i > 0:
+		p.reportAt(p.text, Warning, "%s has arguments but no FUNCDATA $FUNCDATA_ArgsPointerMaps; the garbage collector will not see them", p.funcName)
+		return
+	}
+	name := p.funcName + ".args_stackmap"
+	prog := p.newProg(p.arch.AFUNCDATA)
+	prog.From.Typ = p.arch.D_CONST
+	prog.From.Offset = funcdataNames["FUNCDATA_ArgsPointerMaps"]
+	prog.To = p.symbolAddr(&Addr{symbol: name, hasRegister: true, register: rSB, isIndirect: true}, name)
+	// Count it like an explicit FUNCDATA, but leave any pending labels for the next instruction.
+	pending := p.pendingLabels
+	p.pendingLabels = nil
+	p.link(prog, true)
+	p.pendingLabels = pending
+}
+
+// patch reports the jumps to labels that were not defined in the jump's own function.
+func (p *Parser) patch() {
+	for _, patch := range p.unresolved {
+		if fn, ok := p.labelFuncs[patch.label]; ok && fn != patch.fn {
+			p.reportAt(patch, Error, "jump to label %s in function %s from %s; labels are local to their function",
+				labelName(patch.label), fn, patch.fn)
+		} else {
+			p.reportAt(patch, Error, "undefined label %s", labelName(patch.label))
+		}
+	}
+}
+
+// reportAt reports a diagnostic at the position of the instruction recorded in patch.
+func (p *Parser) reportAt(patch Patch, severity Severity, format string, args ...interface{}) {
+	p.at = patch.at
+	d := p.diagnostic(severity, format, args...)
+	d.File, d.Line = patch.file, patch.line
+	if p.diag.Report(d) {
+		panic(bailout{})
+	}
+}
+
+func (p *Parser) branch(jmp, target *liblink.Prog) {
+	jmp.To = p.arch.noAddr
+	jmp.To.Typ = p.arch.D_BRANCH
+	jmp.To.U.Branch = target
+}
+
+// asmInstruction assembles an instruction. The arch's shape table says
+// where in the Prog each operand goes; see shape.
+// MOVW R9, (R10)
+func (p *Parser) asmInstruction(op int, word string, addr []Addr) {
+	prog := p.newProg(op)
+	slots := p.arch.shape(op, len(addr))
+	if slots == nil {
+		p.errorf("%s does not take %d operands", word, len(addr))
+		return
+	}
+	p.checkOperands(op, word, slots, addr)
+	// Whole addresses first, so the slots that fill in parts of them are not overwritten.
+	// Diagnostics about an operand point at it.
+	for i, s := range slots {
+		a := &addr[i]
+		p.at = a.at
+		if a.has(addrRegister2) && p.arch.Thechar != '5' && s != slotToPair {
+			p.errorf("register pair not allowed as operand %d of %s", i+1, word)
+		}
+		switch s {
+		case slotFrom:
+			prog.From = p.addrToAddr(a)
+		case slotTo, slotToPair:
+			prog.To = p.addrToAddr(a)
+		case slotFrom3:
+			prog.From3 = p.addrToAddr(a)
+		}
+	}
+	for i, s := range slots {
+		a := &addr[i]
+		p.at = a.at
+		switch s {
+		case slotReg:
+			prog.Reg = p.regNumber(a)
+		case slotToConst:
+			if !a.is(addrOffset) {
+				p.errorf("expected constant for operand %d of %s", i+1, word)
+			}
+			prog.To.Offset = a.offset
+		case slotToImm:
+			if !a.is(addrImmediateConstant | addrOffset) {
+				p.errorf("expected $constant for operand %d of %s", i+1, word)
+			}
+			prog.To.Offset = a.offset
+		case slotFromIndex, slotToPair:
+			if s == slotToPair && !a.has(addrRegister2) {
+				// SHLQ $4, AX: a single shift, with only To.
+				break
+			}
+			reg := a.register
+			if s == slotToPair {
+				if !a.is(addrRegister | addrRegister2) {
+					p.errorf("expected register pair for operand %d of %s", i+1, word)
+				}
+				reg = a.register2
+			} else if !a.is(addrRegister) {
+				p.errorf("expected register for operand %d of %s", i+1, word)
+			}
+			if prog.From.Index != p.arch.D_NONE {
+				p.errorf("first operand of %s cannot be indexed", word)
+			}
+			prog.From.Index = reg
+		case slotToReg:
+			prog.To.Typ = arm.D_REGREG2
+			prog.To.Reg = p.armRegisterNumber(a)
+		case slotToReg2:
+			prog.To.Offset = int64(p.armRegisterNumber(a))
+		}
+	}
+	p.at = p.inst
+	p.link(prog, true)
+}
@@ -0,0 +1,167 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package asm implements the Go assembler. It turns assembly source for
+// one of the supported architectures into a Go object file.
+//
+// The package has no global state, so independent assemblies may run
+// concurrently.
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+// Options control an assembly. The zero value is a usable default.
+type Options struct {
+	// Defines holds the predefined macros, each "name" or "name=value".
+	Defines []string
+	// IncludeDirs are searched for #include files after the directory of the source file.
+	IncludeDirs []string
+	// TrimPath is a prefix removed from the file names recorded in the object.
+	TrimPath string
+	// MaxErrors is the number of errors after which assembly stops. Zero means no limit.
+	MaxErrors int
+	// Handle, if not nil, is called with each diagnostic as it is reported.
+	Handle func(Diagnostic)
+	// Debug, if not nil, receives liblink's dump of the assembly and machine code.
+	Debug io.Writer
+	// List, if not nil, receives a listing of the program in Go assembler syntax,
+	// with the PC and machine code of each instruction. The listing can itself be
+	// assembled, and produces the same machine code.
+	List io.Writer
+	// Dialect is the syntax of the source. The GNU dialect, for importing
+	// hand-written x86 code, is described in gnu.go.
+	Dialect Dialect
+	// Trace selects the categories of tracing written to TraceOut.
+	Trace Trace
+	// TraceOut, if not nil, receives a line for each event in the categories selected by Trace.
+	// Tracing does not change the object.
+	TraceOut io.Writer
+	// FS, if not nil, provides the #include files in place of the operating system.
+	FS FileSystem
+	// GOOS is the operating system recorded in the object. GOOS and GOARCH also
+	// replace _GOOS and _GOARCH in #include names. The defaults are liblink's
+	// GOOS and the architecture being assembled.
+	GOOS, GOARCH string
+}
+
+// setDefaults fills in the options that were left empty for assembling arch.
+func (opts *Options) setDefaults(arch string) {
+	if opts.GOOS == "" {
+		opts.GOOS = liblink.Getgoos()
+	}
+	if opts.GOARCH == "" {
+		opts.GOARCH = arch
+	}
+}
+
+// A FileSystem opens the files read by #include. Each name is the #include name
+// joined, with filepath.Join, to the directory of the source, to one of
+// Options.IncludeDirs, or to nothing; it is relative if they are.
+type FileSystem interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+// osFS is the FileSystem of the operating system.
+type osFS struct{}
+
+func (osFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// An Object is the result of a successful assembly.
+type Object struct {
+	// Data holds the contents of the object file.
+	Data []byte
+	// Includes holds the names of the files read by #include, in the order they were first read.
+	Includes []string
+	// Symbols holds the symbols the source defines and refers to, sorted by name.
+	Symbols []Symbol
+}
+
+// Assemble assembles the source read from r for the named GOARCH. The name of the
+// source is used in diagnostics and recorded in the object; #include files are
+// found relative to it. Assemble returns the object, which is nil if there were
+// errors, and all the diagnostics reported.
+func Assemble(arch, name string, r io.Reader, opts Options) (*Object, []Diagnostic) {
+	diag := &Diagnostics{
+		Handle:    opts.Handle,
+		MaxErrors: opts.MaxErrors,
+	}
+	a := LookupArch(arch)
+	if a == nil {
+		diag.Report(Diagnostic{File: name, Severity: Error, Msg: fmt.Sprintf("unrecognized architecture %s", arch)})
+		return nil, diag.List
+	}
+
+	ctxt := liblink.Linknew(a.LinkArch)
+	debug := opts.Debug
+	if debug != nil {
+		ctxt.Debugasm = 1
+	} else {
+		debug = ioutil.Discard
+	}
+	ctxt.Bso = liblink.Binitw(debug)
+	defer liblink.Bflush(ctxt.Bso)
+	ctxt.Diag = func(format string, args ...interface{}) {
+		diag.Report(Diagnostic{File: name, Severity: Error, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	opts.setDefaults(arch)
+	lexer := NewLexer(name, r, ctxt, diag, &opts)
+	parser := NewParser(ctxt, a, lexer, diag)
+	parser.trace = newTracer(&opts)
+	if opts.Dialect == DialectGNU {
+		if a.Thechar != '6' && a.Thechar != '8' {
+			diag.Report(Diagnostic{File: name, Severity: Error, Msg: fmt.Sprintf("the GNU dialect is supported only on 386 and amd64, not %s", arch)})
+			return nil, diag.List
+		}
+		parser.gnu = newGNUState()
+	}
+	pList := liblink.Linknewplist(ctxt)
+	var ok bool
+	pList.Firstpc, ok = parser.Parse()
+	if !ok {
+		return nil, diag.List
+	}
+	var list *listing
+	if opts.List != nil {
+		// Format the Progs now, before liblink rewrites them.
+		list = newListing(a, pList.Firstpc)
+	}
+
+	// The object is built in memory, so a failed assembly leaves nothing behind.
+	var obj bytes.Buffer
+	output := liblink.Binitw(&obj)
+	liblink.Bprint(output, "go object %s %s %s\n", opts.GOOS, arch, liblink.Getgoversion())
+	liblink.Bprint(output, "!\n")
+	liblink.Writeobj(ctxt, output)
+	liblink.Bflush(output)
+	if diag.ErrorCount() > 0 {
+		// The linker library found problems; don't return a bad object.
+		return nil, diag.List
+	}
+	if list != nil {
+		if err := list.write(opts.List); err != nil {
+			diag.Report(Diagnostic{File: name, Severity: Error, Msg: fmt.Sprintf("writing listing: %v", err)})
+			return nil, diag.List
+		}
+	}
+	return &Object{Data: obj.Bytes(), Includes: lexer.Included(), Symbols: parser.Symbols()}, diag.List
+}
+
+// Dependencies runs only the preprocessor over the source read from r, and returns the
+// names of the files it includes, as they would be during assembly, and the diagnostics
+// reported. The names are nil if there were errors. Since the source is not assembled,
+// it need only be valid up to preprocessing.
+func Dependencies(arch, name string, r io.Reader, opts Options) ([]string, []Diagnostic) {
+	return Preprocess(arch, name, r, ioutil.Discard, opts)
+}
@@ -0,0 +1,398 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAssembleUnknownArch(t *testing.T) {
+	obj, diags := Assemble("vax", "x.s", strings.NewReader(""), Options{})
+	if obj != nil || len(diags) != 1 {
+		t.Fatalf("got %v, %v; want nil object and one diagnostic", obj, diags)
+	}
+}
+
+func TestAssembleConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, arch := range []string{"arm", "ppc64"} {
+			wg.Add(1)
+			go func(arch string) {
+				defer wg.Done()
+				file := "testdata/" + arch + ".s"
+				fd, err := os.Open(file)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer fd.Close()
+				if obj, diags := Assemble(arch, file, fd, Options{}); obj == nil {
+					t.Errorf("failed to assemble %s: %v", file, diags)
+				}
+			}(arch)
+		}
+	}
+	wg.Wait()
+}
+
+var frameTests = []struct {
+	src      string
+	severity Severity // Of the single diagnostic; -1 for none.
+}{
+	{"TEXT f(SB), 0, $0-16\nMOVQ x+8(FP), AX\n", -1},
+	{"TEXT f(SB), 0, $0-16\nMOVQ x+16(FP), AX\n", Error},
+	{"TEXT f(SB), 0, $0-16\nMOVQ x-8(FP), AX\n", Error},
+	{"TEXT f(SB), 0, $0-0\nMOVQ x+0(FP), AX\n", Error},
+	{"TEXT f(SB), 0, $0\nMOVQ x+64(FP), AX\n", -1}, // Argument size not declared.
+	{"TEXT f(SB), 0, $0-16\nMOVQ 8(FP), AX\n", Warning},
+	{"TEXT f(SB), 0, $0-16\nMOVQ AX, ret+16(FP)\nTEXT g(SB), 0, $0-24\nMOVQ AX, ret+16(FP)\n", Error},
+	{"TEXT f(SB), 0, $0-8\nMOVQ x+0(FP), AX\nTEXT g(SB), 0, $0-24\nMOVQ AX, ret+16(FP)\n", -1},
+	// Arguments with no pointer map.
+	{"TEXT ·f(SB), 0, $0-8\nRET\n", -1},
+	{"TEXT pkg·f(SB), 0, $0-8\nRET\n", Warning},
+	{"TEXT pkg·f(SB), 0, $0-8\nFUNCDATA $FUNCDATA_ArgsPointerMaps, args(SB)\nRET\n", -1},
+	{"TEXT pkg·f(SB), 0, $0-8\nFUNCDATA $0, args(SB)\nRET\n", -1},
+	{"TEXT f(SB), 0, $0\nFUNCDATA $FUNCDATA_Bogus, args(SB)\n", Error},
+	{"TEXT f(SB), 0, $0\nPCDATA $FUNCDATA_ArgsPointerMaps, $1\n", Error},
+}
+
+func TestFrameOffsets(t *testing.T) {
+	for _, test := range frameTests {
+		_, diags := Assemble("amd64", "x.s", strings.NewReader(test.src), Options{})
+		switch {
+		case test.severity < 0 && len(diags) != 0:
+			t.Errorf("%q: unexpected diagnostics %v", test.src, diags)
+		case test.severity >= 0 && (len(diags) != 1 || diags[0].Severity != test.severity):
+			t.Errorf("%q: got %v; want one %s", test.src, diags, test.severity)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inc := filepath.Join(dir, "inc")
+	if err := os.Mkdir(inc, 0777); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a.h":            "#include \"textflag.h\"\n",
+		"inc/textflag.h": "#ifndef TEXTFLAG\n#define TEXTFLAG\n#define NOSPLIT 4\n#endif\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The source need not assemble.
+	src := "#include \"a.h\"\n#include \"textflag.h\"\nnot an instruction\n"
+	opts := Options{IncludeDirs: []string{inc}}
+	includes, diags := Dependencies("amd64", filepath.Join(dir, "x.s"), strings.NewReader(src), opts)
+	want := []string{filepath.Join(dir, "a.h"), filepath.Join(inc, "textflag.h")}
+	if !reflect.DeepEqual(includes, want) || len(diags) != 0 {
+		t.Errorf("got %q, %v; want %q", includes, diags, want)
+	}
+
+	// Assembly records the same files.
+	src = "#include \"a.h\"\nTEXT f(SB), NOSPLIT, $0\nRET\n"
+	obj, diags := Assemble("amd64", filepath.Join(dir, "x.s"), strings.NewReader(src), opts)
+	if obj == nil || !reflect.DeepEqual(obj.Includes, want) {
+		t.Errorf("got %v, %v; want includes %q", obj, diags, want)
+	}
+
+	src = "#include \"missing.h\"\n"
+	if includes, diags := Dependencies("amd64", filepath.Join(dir, "x.s"), strings.NewReader(src), opts); includes != nil || len(diags) != 1 {
+		t.Errorf("missing include: got %q, %v; want an error", includes, diags)
+	}
+}
+
+// A memFS is a FileSystem held in memory, keyed by the names the assembler opens.
+type memFS map[string]string
+
+func (fs memFS) Open(name string) (io.ReadCloser, error) {
+	data, ok := fs[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func TestIncludeFS(t *testing.T) {
+	fs := memFS{
+		filepath.Join("src", "zasm_plan9_arm.h"): "#define NOSPLIT 4\n",
+		filepath.Join("src", "zasm_linux_arm.h"): "#define NOSPLIT 4\n",
+		filepath.Join("inc", "textflag.h"):       "#define NOSPLIT 4\n",
+	}
+	src := "#include \"zasm_GOOS_GOARCH.h\"\nTEXT f(SB), NOSPLIT, $0\nRET\n"
+	name := filepath.Join("src", "x.s")
+	want := []string{filepath.Join("src", "zasm_plan9_arm.h")}
+	obj, diags := Assemble("amd64", name, strings.NewReader(src), Options{FS: fs, GOOS: "plan9", GOARCH: "arm"})
+	if obj == nil || !reflect.DeepEqual(obj.Includes, want) {
+		t.Errorf("got %v, %v; want includes %q", obj, diags, want)
+	}
+	// The object records GOOS.
+	if obj != nil && !bytes.HasPrefix(obj.Data, []byte("go object plan9 amd64 ")) {
+		t.Errorf("object header %q; want GOOS plan9", bytes.SplitN(obj.Data, []byte("\n"), 2)[0])
+	}
+
+	// GOARCH defaults to the architecture being assembled.
+	want = []string{filepath.Join("src", "zasm_linux_arm.h")}
+	includes, diags := Dependencies("arm", name, strings.NewReader(src), Options{FS: fs, GOOS: "linux"})
+	if !reflect.DeepEqual(includes, want) {
+		t.Errorf("got %q, %v; want %q", includes, diags, want)
+	}
+
+	// Include directories are joined to the name as they are, not made absolute.
+	src = "#include \"textflag.h\"\n"
+	want = []string{filepath.Join("inc", "textflag.h")}
+	includes, diags = Dependencies("arm", name, strings.NewReader(src), Options{FS: fs, IncludeDirs: []string{"inc"}})
+	if !reflect.DeepEqual(includes, want) {
+		t.Errorf("got %q, %v; want %q", includes, diags, want)
+	}
+
+	// Nothing is read from the operating system.
+	if includes, diags := Dependencies("arm", "x.s", strings.NewReader("#include \"assemble_test.go\"\n"), Options{FS: fs}); includes != nil || len(diags) != 1 {
+		t.Errorf("file outside the FS: got %q, %v; want an error", includes, diags)
+	}
+}
+
+var labelTests = []struct {
+	name string
+	src  string
+	msg  string // Expected diagnostic; empty if the source is valid.
+}{
+	{
+		"same label in two functions",
+		"TEXT f(SB), 0, $0\nloop: JMP loop\nTEXT g(SB), 0, $0\nloop: JMP loop\n",
+		"",
+	},
+	{
+		"jump into another function",
+		"TEXT f(SB), 0, $0\nJMP done\nTEXT g(SB), 0, $0\ndone: RET\n",
+		"x.s:2:1: jump to label done in function g from f; labels are local to their function",
+	},
+	{
+		"undefined label",
+		"TEXT f(SB), 0, $0\nJMP done\n",
+		"x.s:2:1: undefined label done",
+	},
+	{
+		"numeric labels",
+		"TEXT f(SB), 0, $0\n1: NOP\nJMP 1b\nJMP 1f\n1: JMP 1b\n",
+		"",
+	},
+	{
+		"undefined backward numeric label",
+		"TEXT f(SB), 0, $0\nJMP 1b\n1: RET\n",
+		"x.s:2:1: undefined label 1b",
+	},
+	{
+		"forward numeric label in another function",
+		"TEXT f(SB), 0, $0\nJMP 1f\nTEXT g(SB), 0, $0\n1: RET\n",
+		"x.s:2:1: jump to label 1f in function g from f; labels are local to their function",
+	},
+	{
+		"label outside of function",
+		"a: RET\n",
+		"x.s:1:1: label outside of function",
+	},
+	{
+		"numeric label outside of function",
+		"1: RET\n",
+		"x.s:1:1: label outside of function",
+	},
+	{
+		"instruction outside of function",
+		"RET\nTEXT f(SB), 0, $0\nRET\n",
+		"x.s:1:1: instruction outside of function",
+	},
+	{
+		"data before function",
+		"DATA x<>+0(SB)/8, $1\nGLOBL x<>(SB), $8\nTEXT f(SB), 0, $0\nRET\n",
+		"",
+	},
+	{
+		"jump relative to PC",
+		"TEXT f(SB), 0, $0\nJMP 2(PC)\nNOP\nRET\n",
+		"",
+	},
+	{
+		"jump relative to PC out of function",
+		"TEXT f(SB), 0, $0\nJMP 2(PC)\nRET\nTEXT g(SB), 0, $0\nRET\n",
+		"x.s:2:1: jump to 2(PC) leaves function f",
+	},
+}
+
+func TestLabels(t *testing.T) {
+	for _, test := range labelTests {
+		_, diags := Assemble("amd64", "x.s", strings.NewReader(test.src), Options{})
+		var msg string
+		if len(diags) > 0 {
+			msg = diags[0].String()
+		}
+		if msg != test.msg {
+			t.Errorf("%s: got %q; want %q", test.name, msg, test.msg)
+		}
+	}
+}
+
+func TestNumericLabels(t *testing.T) {
+	numeric := list(t, "amd64", "x.s", []byte("TEXT f(SB), 0, $0\n1: NOP\n1: NOP\nJMP 1b\nJMP 1f\n1: JMP 1b\n"))
+	named := list(t, "amd64", "x.s", []byte("TEXT f(SB), 0, $0\na: NOP\nb: NOP\nJMP b\nJMP c\nc: JMP c\n"))
+	if numeric != named {
+		t.Errorf("numeric labels list as\n%s\nwant\n%s", numeric, named)
+	}
+}
+
+var dataTests = []struct {
+	name string
+	src  string
+	msg  string // Expected diagnostic; empty if the source is valid.
+}{
+	{
+		"data within size",
+		"DATA tab<>+0(SB)/8, $1\nDATA tab<>+8(SB)/8, $2\nGLOBL tab<>(SB), 8, $16\n",
+		"",
+	},
+	{
+		"data beyond size",
+		"GLOBL tab<>(SB), 8, $8\nDATA tab<>+0(SB)/8, $1\nDATA tab<>+8(SB)/8, $2\n",
+		"x.s:3:1: DATA for tab ends at offset 16, beyond its GLOBL size 8",
+	},
+	{
+		"data without globl",
+		"DATA tab<>+0(SB)/8, $1\n",
+		"x.s:1:1: DATA for tab, which has no GLOBL",
+	},
+	{
+		"globl twice",
+		"GLOBL tab<>(SB), $8\nGLOBL tab<>(SB), $8\n",
+		"x.s:2:1: tab redeclared; previous GLOBL at x.s:1",
+	},
+	{
+		"negative globl size",
+		"GLOBL tab<>(SB), $-8\n",
+		"x.s:1:1: GLOBL tab: size -8 is negative",
+	},
+	{
+		"globl of text",
+		"TEXT f(SB), 0, $0\nRET\nGLOBL f(SB), $8\n",
+		"x.s:3:1: f is defined as text by TEXT at x.s:1",
+	},
+	{
+		"text flag on globl",
+		"GLOBL tab<>(SB), 4, $8\n",
+		"x.s:1:1: warning: GLOBL tab: flag NOSPLIT applies only to TEXT",
+	},
+	{
+		"rodata without data",
+		"GLOBL tab<>(SB), 8, $8\n",
+		"x.s:1:1: warning: RODATA symbol tab has no DATA",
+	},
+	{
+		"noptr holding an address",
+		"DATA tab<>+0(SB)/8, $tab<>(SB)\nGLOBL tab<>(SB), 16, $8\n",
+		"x.s:1:1: warning: NOPTR symbol tab holds the address of tab; the garbage collector will not see it",
+	},
+}
+
+func TestData(t *testing.T) {
+	for _, test := range dataTests {
+		_, diags := Assemble("amd64", "x.s", strings.NewReader(test.src), Options{})
+		var msg string
+		if len(diags) > 0 {
+			msg = diags[0].String()
+		}
+		if msg != test.msg {
+			t.Errorf("%s: got %q; want %q", test.name, msg, test.msg)
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	src := "TEXT ·f(SB), 4, $16\nMOVQ tab<>(SB), AX\nCALL runtime·g(SB)\nRET\n" +
+		"DATA tab<>+0(SB)/8, $1\nGLOBL tab<>(SB), 8, $8\nGLOBL buf(SB), $64\n"
+	obj, diags := Assemble("amd64", "x.s", strings.NewReader(src), Options{})
+	if obj == nil {
+		t.Fatal(diags)
+	}
+	want := []Symbol{
+		{Name: "·f", Kind: SymbolText, Size: 16, Flags: 4},
+		{Name: "buf", Kind: SymbolBSS, Size: 64},
+		{Name: "runtime·g", Kind: SymbolUndefined},
+		{Name: "tab", Kind: SymbolData, Static: true, Size: 8, Flags: 8},
+	}
+	if !reflect.DeepEqual(obj.Symbols, want) {
+		t.Errorf("got %v; want %v", obj.Symbols, want)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	src := "#define N 8\nTEXT f(SB), 0, $N\nloop:\nADDQ $N, AX\nJMP loop\n#undef N\n"
+	plain, diags := Assemble("amd64", "x.s", strings.NewReader(src), Options{})
+	if plain == nil {
+		t.Fatal(diags)
+	}
+	var trace bytes.Buffer
+	opts := Options{Trace: TraceLex | TraceParse | TraceLink, TraceOut: &trace}
+	traced, diags := Assemble("amd64", "x.s", strings.NewReader(src), opts)
+	if traced == nil {
+		t.Fatal(diags)
+	}
+	if !bytes.Equal(plain.Data, traced.Data) {
+		t.Error("tracing changed the object")
+	}
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	want := []string{
+		"x.s:1: lex: #define N",
+		"x.s:2: parse: TEXT [f(SB)] [0] [$8]",
+		"x.s:2: link: ",
+		"x.s:3: parse: label loop:",
+		"x.s:4: parse: ADDQ [$8] [AX]",
+		"x.s:4: link: ",
+		"x.s:5: parse: JMP [loop]",
+		"x.s:5: link: ",
+		"x.s:6: lex: #undef N",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got trace\n%s\nwant %d lines", trace.String(), len(want))
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, want[i]) {
+			t.Errorf("trace line %d: got %q; want %q", i+1, line, want[i])
+		}
+	}
+}
+
+func TestParseTrace(t *testing.T) {
+	tests := []struct {
+		input string
+		trace Trace
+		ok    bool
+	}{
+		{"", 0, true},
+		{"lex", TraceLex, true},
+		{"link,parse", TraceParse | TraceLink, true},
+		{"lex,bogus", 0, false},
+	}
+	for _, test := range tests {
+		trace, err := ParseTrace(test.input)
+		if trace != test.trace || (err == nil) != test.ok {
+			t.Errorf("%q: got %v, %v; want %v, ok=%t", test.input, trace, err, test.trace, test.ok)
+		}
+	}
+}
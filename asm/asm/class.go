@@ -0,0 +1,214 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"strings"
+
+	"code.google.com/p/rsc/c2go/liblink/arm"
+	"code.google.com/p/rsc/c2go/liblink/ppc64"
+)
+
+// A class is a set of kinds of operand. The Arch tables use classes to say
+// which operands an instruction accepts in each slot, so the parser can reject
+// nonsense like MOVL $1, $2 before liblink sees it.
+type class int
+
+const (
+	classReg     class = 1 << iota // General register: AX, R1.
+	classFReg                      // Floating-point register: F0.
+	classVReg                      // Vector register: X0, M0.
+	classSReg                      // Special register: CR0, CPSR, LR.
+	classMem                       // Memory: (AX), x+0(FP), foo(SB).
+	classImm8                      // Immediate that fits in 8 bits, signed or not: $-1, $255.
+	classImm16                     // Immediate that fits in 16 bits, signed or not.
+	classImm32                     // Immediate that fits in 32 bits, signed or not.
+	classImm64                     // Any other immediate, including $1.5 and $"str".
+	classAddr                      // Address: $foo(SB), $x-8(SP).
+	classRegList                   // ARM register list: [R0-R3].
+	classShift                     // ARM shifted register: R1<<2.
+	classRegPair                   // ARM register pair: (R1, R2).
+
+	classRegisters = classReg | classFReg | classVReg | classSReg
+	classImm       = classImm8 | classImm16 | classImm32 | classImm64
+)
+
+// An operandClasses says which classes of operand each slot of an instruction
+// accepts. Slots that are not present are not checked.
+type operandClasses map[slot]class
+
+var classNames = []struct {
+	class class
+	name  string
+}{
+	{classRegisters, "register"},
+	{classReg, "general register"},
+	{classFReg, "floating-point register"},
+	{classVReg, "vector register"},
+	{classSReg, "special register"},
+	{classMem, "memory"},
+	{classImm, "immediate"},
+	{classImm8 | classImm16 | classImm32, "32-bit immediate"},
+	{classImm8 | classImm16, "16-bit immediate"},
+	{classImm8, "8-bit immediate"},
+	{classAddr, "address"},
+	{classRegList, "register list"},
+	{classShift, "shifted register"},
+	{classRegPair, "register pair"},
+}
+
+// String describes the class for a diagnostic: "register or memory".
+func (c class) String() string {
+	var names []string
+	for _, n := range classNames {
+		if c&n.class == n.class {
+			names = append(names, n.name)
+			c &^= n.class
+		}
+	}
+	switch len(names) {
+	case 0:
+		return "nothing"
+	case 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// immClass returns the class of the immediate constant v.
+func immClass(v int64) class {
+	switch {
+	case -1<<7 <= v && v < 1<<8:
+		return classImm8
+	case -1<<15 <= v && v < 1<<16:
+		return classImm16
+	case -1<<31 <= v && v < 1<<32:
+		return classImm32
+	}
+	return classImm64
+}
+
+// operandClass returns the class of the operand a.
+func (p *Parser) operandClass(a *Addr) class {
+	switch {
+	case a.isImmediateAddress:
+		return classAddr
+	case a.isImmediateConstant:
+		if a.has(addrFloat | addrString) {
+			return classImm64
+		}
+		return immClass(a.offset)
+	case a.has(addrRegList):
+		return classRegList
+	case a.has(addrShift):
+		return classShift
+	case p.arch.Thechar == '5' && a.has(addrRegister2):
+		return classRegPair
+	case a.isIndirect || a.has(addrSymbol|addrIndex|addrOffset):
+		return classMem
+	case a.has(addrRegister):
+		return p.arch.registerClass(a.register)
+	}
+	return 0
+}
+
+// registerClass returns the class of the register r, a value from Arch.registers.
+func (a *Arch) registerClass(r int) class {
+	switch r {
+	case rSP:
+		return classReg
+	case rFP, rSB, rPC:
+		// Pseudo-registers can only be used in memory operands.
+		return 0
+	}
+	var reg, freg int
+	switch a.Thechar {
+	case '5':
+		reg, freg = arm.D_REG, arm.D_FREG
+	case '9':
+		reg, freg = ppc64.D_REG, ppc64.D_FREG
+	default:
+		return a.regClasses[r]
+	}
+	switch typ, _ := riscRegisterType(r); typ {
+	case reg:
+		return classReg
+	case freg:
+		return classFReg
+	}
+	return classSReg
+}
+
+// x86RegisterClasses classifies the x86 registers by name.
+func x86RegisterClasses(registers map[string]int) map[int]class {
+	classes := make(map[int]class)
+	for name, r := range registers {
+		if r < 0 {
+			continue // Pseudo-register; see registerClass.
+		}
+		c := classSReg // CS, CR0, GDTR etc.
+		switch {
+		case numbered(name, "X"), numbered(name, "M"):
+			c = classVReg
+		case numbered(name, "F"):
+			c = classFReg
+		case len(name) > 1 && name[0] == 'R' && '0' <= name[1] && name[1] <= '9': // R8, R8B
+			c = classReg
+		case len(name) == 2 && strings.IndexByte("ABCD", name[0]) >= 0 && strings.IndexByte("XLH", name[1]) >= 0:
+			c = classReg
+		case strings.HasPrefix(name, "SI"), strings.HasPrefix(name, "DI"),
+			strings.HasPrefix(name, "SP"), strings.HasPrefix(name, "BP"): // SI, SIB etc.
+			c = classReg
+		}
+		classes[r] = c
+	}
+	return classes
+}
+
+// numbered reports whether name is prefix followed by a decimal number.
+func numbered(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+		return false
+	}
+	for _, c := range name[len(prefix):] {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return true
+}
+
+// checkOperands reports an error if the operands of the instruction op,
+// placed in the given slots, are not of the classes the instruction accepts.
+func (p *Parser) checkOperands(op int, word string, slots shape, addr []Addr) {
+	classes := p.arch.classes[op]
+	if classes == nil {
+		classes = p.arch.defaultClasses
+	}
+	mem := 0
+	for i, s := range slots {
+		c := p.operandClass(&addr[i])
+		if c == classMem && (s == slotFrom || s == slotTo || s == slotFrom3) {
+			mem++
+		}
+		want, ok := classes[s]
+		if !ok || c&want != 0 {
+			continue
+		}
+		p.at = addr[i].at
+		switch s {
+		case slotFrom:
+			p.errorf("%s: source must be %s", word, want)
+		case slotTo:
+			p.errorf("%s: destination must be %s", word, want)
+		default:
+			p.errorf("%s: operand %d must be %s", word, i+1, want)
+		}
+	}
+	p.at = p.inst
+	if mem > 1 {
+		p.errorf("%s: at most one operand may be memory", word)
+	}
+}
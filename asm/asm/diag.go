@@ -0,0 +1,89 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+)
+
+// Severity says how serious a Diagnostic is.
+type Severity int
+
+const (
+	Error   Severity = iota // The input cannot be assembled.
+	Warning                 // The input can be assembled but is suspicious.
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A Diagnostic is an error or warning about the input.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Col      int // Zero if not known.
+	Severity Severity
+	Msg      string
+}
+
+// String formats the diagnostic in the traditional way, as in "x.s:12: bad operand".
+func (d Diagnostic) String() string {
+	pos := fmt.Sprintf("%s:%d", d.File, d.Line)
+	if d.Col > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, d.Col)
+	}
+	if d.Severity == Warning {
+		return fmt.Sprintf("%s: warning: %s", pos, d.Msg)
+	}
+	return fmt.Sprintf("%s: %s", pos, d.Msg)
+}
+
+// Diagnostics collects the diagnostics from an assembly.
+type Diagnostics struct {
+	// Handle, if not nil, is called with each diagnostic as it is reported.
+	Handle func(Diagnostic)
+	// MaxErrors is the number of errors after which assembly stops. Zero means no limit.
+	MaxErrors int
+	// List holds all the diagnostics reported, in order.
+	List   []Diagnostic
+	errors int
+}
+
+// bailout is the panic value used to abandon an assembly. It is recovered by Parser.Parse.
+type bailout struct{}
+
+// Report records the diagnostic. It reports whether the error limit has now been
+// reached, in which case the caller should stop.
+func (d *Diagnostics) Report(diag Diagnostic) bool {
+	d.add(diag)
+	if diag.Severity != Error {
+		return false
+	}
+	d.errors++
+	if d.MaxErrors > 0 && d.errors == d.MaxErrors {
+		d.add(Diagnostic{File: diag.File, Line: diag.Line, Severity: Error, Msg: "too many errors"})
+		return true
+	}
+	return d.MaxErrors > 0 && d.errors > d.MaxErrors
+}
+
+func (d *Diagnostics) add(diag Diagnostic) {
+	d.List = append(d.List, diag)
+	if d.Handle != nil {
+		d.Handle(diag)
+	}
+}
+
+// ErrorCount returns the number of errors reported.
+func (d *Diagnostics) ErrorCount() int {
+	return d.errors
+}
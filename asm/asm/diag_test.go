@@ -0,0 +1,135 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		diag Diagnostic
+		want string
+	}{
+		{Diagnostic{File: "x.s", Line: 3, Severity: Error, Msg: "bad"}, "x.s:3: bad"},
+		{Diagnostic{File: "x.s", Line: 3, Col: 7, Severity: Error, Msg: "bad"}, "x.s:3:7: bad"},
+		{Diagnostic{File: "x.s", Line: 3, Severity: Warning, Msg: "odd"}, "x.s:3: warning: odd"},
+	}
+	for _, test := range tests {
+		if got := test.diag.String(); got != test.want {
+			t.Errorf("%#v: got %q; want %q", test.diag, got, test.want)
+		}
+	}
+}
+
+// errorCount returns the number of errors in the diagnostics.
+func errorCount(diags []Diagnostic) int {
+	n := 0
+	for _, d := range diags {
+		if d.Severity == Error && d.Msg != "too many errors" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMaxErrors(t *testing.T) {
+	src := strings.Repeat("BOGUS\n", 20)
+	obj, diags := Assemble("amd64", "x.s", strings.NewReader(src), Options{MaxErrors: 5})
+	if obj != nil {
+		t.Fatal("bad input assembled")
+	}
+	if n := errorCount(diags); n != 5 {
+		t.Errorf("got %d errors; want 5", n)
+	}
+	last := diags[len(diags)-1]
+	if last.Msg != "too many errors" || last.Line != 5 {
+		t.Errorf("last diagnostic is %v; want x.s:5: too many errors", last)
+	}
+
+	_, diags = Assemble("amd64", "x.s", strings.NewReader(src), Options{})
+	if n := errorCount(diags); n != 20 {
+		t.Errorf("with no limit got %d errors; want 20", n)
+	}
+}
+
+func TestPreprocessorError(t *testing.T) {
+	obj, diags := Assemble("amd64", "x.s", strings.NewReader("#bogus\n"), Options{})
+	if obj != nil {
+		t.Fatal("bad input assembled")
+	}
+	if len(diags) != 1 || diags[0].Line != 1 || diags[0].File != "x.s" {
+		t.Errorf("got %v; want one error at x.s:1", diags)
+	}
+}
+
+// Malformed tokens are reported like any other error, not printed by the scanner.
+func TestScanError(t *testing.T) {
+	for _, test := range []struct{ src, want string }{
+		{"TEXT f(SB), 0, $0\n\tMOVQ $\"ab, AX\n", "x.s:2:8: literal not terminated"},
+		{"TEXT f(SB), 0, $0\n/* x\n", "x.s:2:1: comment not terminated"},
+	} {
+		obj, diags := Assemble("amd64", "x.s", strings.NewReader(test.src), Options{})
+		if obj != nil || len(diags) == 0 || diags[0].String() != test.want {
+			t.Errorf("%q: got %q; want %q", test.src, diags, test.want)
+		}
+	}
+}
+
+func TestDefineError(t *testing.T) {
+	obj, diags := Assemble("amd64", "x.s", strings.NewReader("TEXT f(SB), 0, $0\nRET\n"), Options{Defines: []string{"S=\"abc"}})
+	want := "-D: invalid value \"\\\"abc\" for macro S"
+	if obj != nil || len(diags) != 1 || diags[0].Msg != want {
+		t.Errorf("got %v, %q; want %q", obj, diags, want)
+	}
+}
+
+var positionTests = []struct {
+	src  string
+	want string
+}{
+	{
+		"TEXT f(SB), 0, $0\n\tFOO AX\n",
+		"x.s:2:2: unrecognized instruction FOO",
+	},
+	{
+		"TEXT f(SB), 0, $0\n\tMOVQ AX, (BX\n",
+		"x.s:2:11: expected ')', found end",
+	},
+	{
+		"TEXT f(SB), 0, $0-16\n\tMOVQ AX, 8(FP)\n",
+		"x.s:2:11: warning: 8(FP) has no name; use a name like x+8(FP)",
+	},
+	{
+		"TEXT f(SB), 0, $0\n\tMOVQ AX,   ZZ\n",
+		"x.s:2:13: invalid register for symbol ZZ",
+	},
+	{
+		"TEXT f(SB), 0, $0\n\tMOVQ $1, $2\n",
+		"x.s:2:11: MOVQ: destination must be register or memory",
+	},
+	{
+		"TEXT f(SB), 0, $0\n\tMOVQ (AX), (BX)\n",
+		"x.s:2:2: MOVQ: at most one operand may be memory",
+	},
+	{
+		"#define STORE(r) MOVQ AX, 8(r\nTEXT f(SB), 0, $0\n\tSTORE(BX)\n",
+		"x.s:3:2: expected ')', found end (in expansion of STORE defined at x.s:1)",
+	},
+	{
+		"#define STORE(r) MOVQ AX, 8(r\n#define S STORE(BX)\nTEXT f(SB), 0, $0\n\tS\n",
+		"x.s:4:2: expected ')', found end (in expansion of STORE defined at x.s:1, in expansion of S defined at x.s:2)",
+	},
+}
+
+func TestPositions(t *testing.T) {
+	for _, test := range positionTests {
+		_, diags := Assemble("amd64", "x.s", strings.NewReader(test.src), Options{})
+		if len(diags) != 1 || diags[0].String() != test.want {
+			t.Errorf("%q: got %q; want %q", test.src, diags, test.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"testing"
+)
+
+var exprTests = []struct {
+	input  string
+	output uint64
+	ok     bool
+}{
+	// Constants.
+	{"0", 0, true},
+	{"3", 3, true},
+	{"0x10", 16, true},
+	{"010", 8, true},
+	{"0xFFFFFFFFFFFFFFFF", 1<<64 - 1, true},
+	{"0x10000000000000000", 0, false},
+	// Unary operators.
+	{"+3", 3, true},
+	{"-3", -3 & (1<<64 - 1), true},
+	{"~0", 1<<64 - 1, true},
+	{"~-1", 0, true},
+	{"--3", 3, true},
+	{"-0x8000000000000000", 1 << 63, true},
+	{"-0x8000000000000001", 0, false},
+	{"-(-0x8000000000000000)", 0, false},
+	// Addition.
+	{"3+4", 7, true},
+	{"0xFFFFFFFFFFFFFFFF+1", 0, false},
+	{"-1+1", 0, true},
+	{"0x7FFFFFFFFFFFFFFF+-1", 1<<63 - 2, true},
+	{"-0x8000000000000000+-1", 0, false},
+	{"0x8000000000000000+-1", 0, false}, // Too big to be signed.
+	// Subtraction.
+	{"7-4", 3, true},
+	{"4-7", -3 & (1<<64 - 1), true},
+	{"0-0x8000000000000000", 1 << 63, true},
+	{"0-0x8000000000000001", 0, false},
+	{"-0x8000000000000000-1", 0, false},
+	{"10-3-2", 5, true},
+	// Multiplication.
+	{"3*4", 12, true},
+	{"2+3*4", 14, true},
+	{"(2+3)*4", 20, true},
+	{"0x100000000*0x100000000", 0, false},
+	{"-2*3", -6 & (1<<64 - 1), true},
+	{"-0x4000000000000000*2", 1 << 63, true},
+	{"0x4000000000000000*-4", 0, false},
+	// Division and remainder.
+	{"12/4", 3, true},
+	{"13%4", 1, true},
+	{"-13/4", -3 & (1<<64 - 1), true},
+	{"-13%4", -1 & (1<<64 - 1), true},
+	{"0xFFFFFFFFFFFFFFFF/2", 1<<63 - 1, true},
+	{"100/10/5", 2, true},
+	{"1/0", 0, false},
+	{"1%0", 0, false},
+	{"-1/0", 0, false},
+	{"-0x8000000000000000/-1", 0, false},
+	// Shifts.
+	{"1<<4", 16, true},
+	{"1<<63", 1 << 63, true},
+	{"1<<64", 0, false},
+	{"1<<-1", 0, false},
+	{"3<<63", 0, false},
+	{"-1<<63", 1 << 63, true},
+	{"-2<<63", 0, false},
+	{"0x100>>4", 16, true},
+	{"0xFFFFFFFFFFFFFFFF>>60", 15, true},
+	{"-16>>2", -4 & (1<<64 - 1), true},
+	{"1>>64", 0, false},
+	{"1+1<<4", 17, true},
+	// Bitwise operators.
+	{"0xF0&0x3C", 0x30, true},
+	{"0xF0|0x0F", 0xFF, true},
+	{"0xF0^0xFF", 0x0F, true},
+	{"-1&0xFF", 0xFF, true},
+	{"1|2&3", 3, true},
+	{"6&3|8", 10, true},
+	// Errors.
+	{"(1+2", 0, false},
+	{"1+", 0, false},
+	{"*2", 0, false},
+}
+
+func TestExpr(t *testing.T) {
+	for _, test := range exprTests {
+		p := newTestParser(archAmd64())
+		p.start(tokenize(test.input))
+		result := p.expr()
+		if p.peek() != end.Token {
+			p.errorf("extra input")
+		}
+		ok := p.diag.ErrorCount() == 0
+		if ok != test.ok {
+			t.Errorf("%s: ok=%t; want %t (%v)", test.input, ok, test.ok, p.diag.List)
+			continue
+		}
+		if ok && result != test.output {
+			t.Errorf("%s: got %#x; want %#x", test.input, result, test.output)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+// The fuzzer mutates valid sources and checks that the assembler reports errors
+// for whatever it is given, and never panics. A short run is part of the tests;
+// go test -run=Fuzz -fuzzcount=100000 runs a long one. A crasher it finds belongs in
+// the crashers table below once it is fixed.
+var (
+	fuzzIterations = flag.Int("fuzzcount", 300, "number of mutated sources to try in TestFuzz")
+	fuzzSeed       = flag.Int64("fuzzseed", 1, "random seed for TestFuzz")
+)
+
+// fuzzFS holds the files #include finds.
+var fuzzFS = memFS{
+	"a.h":        "#define A(x, y) ((x)+(y))\n#define B A(1, 2)\n#define S(x) #x\n",
+	"guard.h":    "#ifndef GUARD_H\n#define GUARD_H\n#define G 8\n#endif\n",
+	"once.h":     "#pragma once\n#define O 16\n",
+	"self.h":     "#include \"self.h\"\n",
+	"textflag.h": "#define NOSPLIT 4\n#define RODATA 8\n#define NOPTR 16\n",
+	"badlit.h":   "DATA x+0(SB)/8, $\"abc\nGLOBL x(SB), $8\n",
+}
+
+// fuzzSnippets are seeds that exercise the preprocessor, which the corpus files do not.
+var fuzzSnippets = []string{
+	"#include \"a.h\"\n#include \"guard.h\"\n#include \"guard.h\"\n#include \"once.h\"\n" +
+		"TEXT f(SB), NOSPLIT, $G\nMOVQ $A(G, O), AX\nMOVQ $B, BX\nRET\n",
+	"#include \"textflag.h\"\n#define N 3\n#if N > 2 && defined(NOSPLIT)\nDATA x<>+0(SB)/8, $N\n" +
+		"#elif N\n#error\n#else\n#endif\nGLOBL x<>(SB), RODATA|NOPTR, $8\n",
+	"#include \"self.h\"\n",
+	"#define LOOP(r) \\\n\tDECQ r; \\\n\tJNE 1(PC)\nTEXT g(SB), 0, $0-8\nLOOP(CX)\n#undef LOOP\n#line 10 \"y.s\"\nRET\n",
+	"TEXT h(SB), 0, $16-24\nPCDATA $0, $1\nFUNCDATA $0, h·args(SB)\nMOVQ x+0(FP), AX\n" +
+		"a: ADDQ $(1<<3|2), AX\nJMP a\nMOVQ $\"ab\", BX\nRET\n",
+}
+
+// fuzzGNUSnippets are seeds for the GNU dialect.
+var fuzzGNUSnippets = []string{
+	".text\n.globl f\n.type f, @function\nf:\n\tmovq 8(%rsp), %rax # isn't it\n" +
+		"1: decq %rcx\n\tjnz 1b\n\tlock; xaddl %eax, (%rbx,%rcx,4)\n\tleaq tab(%rip), %rdx\n\tret\n",
+	".section .rodata\n.align 16\n.Lc:\n\t.quad 1, .Lc\n\t.asciz \"hi\"\n.bss\nb:\n\t.zero 8\n.comm c, 16\n",
+}
+
+// fuzzTokens are spliced into the sources; they are chosen to reach the edges of the grammar.
+var fuzzTokens = []string{
+	"#", "#define", "#include", "#if", "#ifdef", "#else", "#endif", "#undef", "#line", "#pragma",
+	"(", ")", "[", "]", ",", ";", "$", "*", "/", "%", "<<", ">>", "->", "@>", "-", "~", "\\", "\n",
+	"(SB)", "(FP)", "(SP)", "<>", "·", "\"", "'", "/*", "//", "0x", "1e9", "9999999999999999999999",
+	"A(", "B", "S(", "TEXT", "DATA", "GLOBL", "PCDATA", "FUNCDATA", "JMP", "CALL", ":", "1b", "1f",
+	"%rax", "%st", "(%rip)", ".quad", ".data", ".text", ".globl", "@function", "lock", "\x00", "\xff",
+}
+
+// fuzzSeeds returns the sources the fuzzer mutates for the architecture.
+func fuzzSeeds(t *testing.T, arch string) []string {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", arch+".s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := append([]string{string(data)}, fuzzSnippets...)
+	// Small seeds mutate into more interesting programs than whole files.
+	return append(seeds, strings.SplitAfter(string(data), "\n\n")...)
+}
+
+// mutate returns a random variation of src.
+func mutate(r *rand.Rand, src string, seeds []string) string {
+	b := []byte(src)
+	for n := 1 + r.Intn(4); n > 0; n-- {
+		i := r.Intn(len(b) + 1)
+		j := i
+		if i < len(b) {
+			j = i + r.Intn(min(len(b)-i, 16)+1)
+		}
+		switch r.Intn(5) {
+		case 0: // Replace a byte.
+			if i < len(b) {
+				b[i] = "#(),$*<>\\\"'\n 0aZ:;%.-\x00\x80"[r.Intn(22)]
+			}
+		case 1: // Insert a token.
+			b = splice(b, i, i, []byte(fuzzTokens[r.Intn(len(fuzzTokens))]))
+		case 2: // Delete a range.
+			b = splice(b, i, j, nil)
+		case 3: // Duplicate a range.
+			b = splice(b, i, i, append([]byte(nil), b[i:j]...))
+		case 4: // Insert part of another seed.
+			s := seeds[r.Intn(len(seeds))]
+			k := r.Intn(len(s) + 1)
+			b = splice(b, i, i, []byte(s[k:k+r.Intn(min(len(s)-k, 64)+1)]))
+		}
+	}
+	return string(b)
+}
+
+func splice(b []byte, i, j int, s []byte) []byte {
+	return append(b[:i:i], append(s, b[j:]...)...)
+}
+
+func min(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// A fuzzTarget reads the source, which may be anything, with the -D definitions,
+// and must not panic except with a bailout.
+type fuzzTarget struct {
+	name string
+	run  func(arch string, defines []string, src string)
+}
+
+var fuzzTargets = []fuzzTarget{
+	{"tokenizer", fuzzTokenizer},
+	{"input", fuzzInput},
+	{"parser", func(arch string, defines []string, src string) {
+		fuzzParser(arch, &Options{Defines: defines, FS: fuzzFS}, src)
+	}},
+	{"gnu", func(arch string, defines []string, src string) {
+		fuzzParser("amd64", &Options{Defines: defines, FS: fuzzFS, Dialect: DialectGNU}, src)
+	}},
+}
+
+// fuzzTokenizer reads the tokens of src to EOF.
+func fuzzTokenizer(arch string, defines []string, src string) {
+	t := NewTokenizer("x.s", strings.NewReader(src), nil)
+	t.s.Error = func(*scanner.Scanner, string) {}
+	for i := 0; t.Next() != scanner.EOF; i++ {
+		if i > 10*len(src)+10 {
+			panic("tokenizer does not reach EOF")
+		}
+		t.Text()
+	}
+}
+
+// fuzzInput preprocesses src, as Preprocess does.
+func fuzzInput(arch string, defines []string, src string) {
+	opts := &Options{Defines: defines, FS: fuzzFS}
+	in := NewLexer("x.s", strings.NewReader(src), liblink.Linknew(LookupArch(arch).LinkArch), &Diagnostics{MaxErrors: 10}, opts)
+	preprocess(in, &tokenWriter{w: bufio.NewWriter(ioutil.Discard), file: "x.s", line: 1})
+}
+
+// fuzzParser parses src with the options, as Assemble does.
+func fuzzParser(arch string, opts *Options, src string) {
+	diag := &Diagnostics{MaxErrors: 10}
+	a := LookupArch(arch)
+	ctxt := liblink.Linknew(a.LinkArch)
+	ctxt.Bso = liblink.Binitw(ioutil.Discard)
+	ctxt.Diag = func(string, ...interface{}) {}
+	in := NewLexer("x.s", strings.NewReader(src), ctxt, diag, opts)
+	p := NewParser(ctxt, a, in, diag)
+	if opts.Dialect == DialectGNU {
+		p.gnu = newGNUState()
+	}
+	p.Parse()
+}
+
+// fuzzRun runs the target on src, returning the panic, if any, with its stack.
+func fuzzRun(target fuzzTarget, arch string, defines []string, src string) (crash string) {
+	defer func() {
+		if e := recover(); e != nil {
+			crash = fmt.Sprintf("%v\n%s", e, debug.Stack())
+		}
+	}()
+	target.run(arch, defines, src)
+	return ""
+}
+
+func TestFuzz(t *testing.T) {
+	r := rand.New(rand.NewSource(*fuzzSeed))
+	for _, arch := range []string{"amd64", "arm", "ppc64"} {
+		seeds := fuzzSeeds(t, arch)
+		if arch == "amd64" {
+			seeds = append(seeds, fuzzGNUSnippets...)
+		}
+		failed := false
+		for i := 0; i < *fuzzIterations && !failed; i++ {
+			src := mutate(r, seeds[r.Intn(len(seeds))], seeds)
+			for _, target := range fuzzTargets {
+				if crash := fuzzRun(target, arch, nil, src); crash != "" {
+					t.Errorf("%s %s: crash on %q: %s", arch, target.name, src, crash)
+					failed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// crashers are sources that once made the assembler panic, or that reach code
+// fixed along with those panics: malformed tokens were printed by the scanner
+// instead of being reported.
+var crashers = []struct {
+	arch    string
+	defines []string
+	src     string
+}{
+	{"amd64", nil, "TEXT f(SB), 0\n"},
+	{"arm", nil, "TEXT f(SB)\n"},
+	{"amd64", nil, "DATA x+0(SB)/8\n"},
+	{"amd64", nil, "DATA , $1\n"},
+	{"ppc64", nil, "GLOBL x(SB)\n"},
+	{"amd64", nil, "TEXT f(SB), 0, $0\nPCDATA $1\n"},
+	{"amd64", nil, "TEXT f(SB), 0, $0\nFUNCDATA $1\n"},
+	// A malformed token in an included file.
+	{"amd64", nil, "#include \"badlit.h\"\n"},
+	// Pasting that makes an unterminated literal.
+	{"amd64", nil, "#define P(a,b) a##b\nP(\",x)\n"},
+	{"amd64", nil, "#define Q(a) a ## '\nQ(x)\n"},
+	// A -D value that is not made of tokens.
+	{"amd64", []string{"S=\"abc"}, "DATA x+0(SB)/8, $S\n"},
+	// A character constant that is only a quote.
+	{"amd64", nil, "#if '"},
+	// A recursive macro whose expansion grows without bound.
+	{"amd64", nil, "#define F(x) F(x x) x\nF(1)\n"},
+	{"amd64", nil, "#define F(x) F(x x) x\n#if F(1)\n#endif\n"},
+	// A GNU comment whose text is not made of tokens.
+	{"amd64", nil, "# don't\n.globl f\nf:\n\tret # it's \"done\n"},
+}
+
+func TestCrashers(t *testing.T) {
+	for _, c := range crashers {
+		for _, target := range fuzzTargets {
+			if crash := fuzzRun(target, c.arch, c.defines, c.src); crash != "" {
+				t.Errorf("%s %s: crash on %q: %s", c.arch, target.name, c.src, crash)
+			}
+		}
+	}
+}
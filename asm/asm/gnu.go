@@ -0,0 +1,939 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// A Dialect is a syntax of assembly language that the parser reads.
+type Dialect int
+
+const (
+	DialectGo  Dialect = iota // The Go assembler's own syntax.
+	DialectGNU                // The AT&T syntax of the GNU assembler, on 386 and amd64 only.
+)
+
+var dialectNames = [...]string{
+	DialectGo:  "go",
+	DialectGNU: "gnu",
+}
+
+// ParseDialect returns the dialect with the given name: go or gnu.
+func ParseDialect(name string) (Dialect, error) {
+	for d, n := range dialectNames {
+		if n == name {
+			return Dialect(d), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dialect %q; want go or gnu", name)
+}
+
+func (d Dialect) String() string {
+	if 0 <= d && int(d) < len(dialectNames) {
+		return dialectNames[d]
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// The GNU dialect is an import aid: it reads the AT&T syntax that GNU as
+// accepts for x86 and turns each statement into what the Go syntax would have
+// produced, so a hand-written kernel can be assembled, listed with -l, and
+// cleaned up from there. Instructions become Addrs directly, with %rax as AX,
+// disp(base,index,scale) as disp(BASE)(INDEX*scale), and sym(%rip) as sym(SB).
+// Labels and directives become pseudo-ops: in .text a label declared by .globl
+// or .type @function, or called before it is defined, starts a TEXT, and in .data, .rodata and .bss a label
+// starts a symbol whose .quad, .long, .ascii etc. become DATA and which gets a
+// GLOBL at its end. Local symbols, those named .L..., become static, foo<>;
+// every other symbol is extern, since a reference may precede the .globl that
+// would decide. Anything that has no Go equivalent, such as segment overrides,
+// x87 registers or assembler macros, is an error rather than a guess.
+
+// gnuState is the Parser's state while reading the GNU dialect.
+type gnuState struct {
+	section   string          // Kind of the current section: text, data, rodata, bss or note.
+	globals   map[string]bool // Names declared by .globl.
+	functions map[string]bool // Names declared by .type name, @function, or defined as functions.
+	called    map[string]bool // Names that call instructions have gone to.
+	labels    map[string]bool // Names defined as labels within a function in .text.
+	data      *gnuData        // The data symbol being defined, if any.
+}
+
+// gnuData is a symbol being defined in a data section. Its GLOBL is written
+// when the next label or section starts, or at the end of the source.
+type gnuData struct {
+	name    string // As in the Go syntax, such as tab or LC0<>.
+	flags   int
+	size    int64
+	hasAddr bool // Some DATA holds an address, so the symbol is not NOPTR.
+}
+
+func newGNUState() *gnuState {
+	return &gnuState{
+		section:   "text",
+		globals:   make(map[string]bool),
+		functions: make(map[string]bool),
+		called:    make(map[string]bool),
+		labels:    make(map[string]bool),
+	}
+}
+
+// gnuLine reads and assembles one statement in the GNU dialect. The first
+// token, tok, has been read. It reports whether there is more input.
+func (p *Parser) gnuLine(tok Token) bool {
+	var tokens []LexToken
+	for tok != '\n' && tok != ';' {
+		if tok == scanner.EOF {
+			p.errorf("unexpected EOF")
+			return false
+		}
+		tokens = append(tokens, p.token(tok))
+		tok = p.lex.Next()
+	}
+	p.gnuStatement(tokens)
+	return true
+}
+
+// gnuStatement assembles the labels, directive or instruction in tokens.
+func (p *Parser) gnuStatement(tokens []LexToken) {
+	for len(tokens) > 0 {
+		p.inst = tokens[0]
+		p.at = p.inst
+		n := gnuLabelLength(tokens)
+		if n == 0 {
+			break
+		}
+		p.gnuLabel(tokens[:n-1])
+		tokens = tokens[n:]
+	}
+	if len(tokens) == 0 {
+		return
+	}
+	switch {
+	case len(tokens) > 1 && tokens[0].Token == '.' && tokens[1].Token == scanner.Ident:
+		operands := p.gnuOperands(tokens[2:])
+		if p.trace.enabled(TraceParse) {
+			p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "%s", statementString("."+tokens[1].text, operands))
+		}
+		p.gnuDirective(tokens[1].text, operands)
+	case tokens[0].Token == scanner.Ident:
+		word := strings.ToLower(tokens[0].text)
+		if prefix := gnuPrefixes[word]; prefix != "" && len(tokens) > 1 {
+			// lock; xaddl or lock xaddl: the prefix is an instruction of its own in Go.
+			p.gnuInstruction(word, nil)
+			p.gnuStatement(tokens[1:])
+			return
+		}
+		operands := p.gnuOperands(tokens[1:])
+		if p.trace.enabled(TraceParse) {
+			p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "%s", statementString(word, operands))
+		}
+		p.gnuInstruction(word, operands)
+	default:
+		p.errorf("expected instruction or directive, found %q", tokens[0].text)
+	}
+}
+
+// gnuLabelLength returns the number of tokens in the label definition at the
+// start of tokens, including the colon, or zero if there is none: foo:, .Lfoo: or 1:.
+func gnuLabelLength(tokens []LexToken) int {
+	switch {
+	case len(tokens) > 1 && tokens[1].Token == ':' && (tokens[0].Token == scanner.Ident || tokens[0].Token == scanner.Int):
+		return 2
+	case len(tokens) > 2 && tokens[0].Token == '.' && tokens[1].Token == scanner.Ident && tokens[2].Token == ':':
+		return 3
+	}
+	return 0
+}
+
+// gnuOperands splits the tokens into comma-separated operands.
+func (p *Parser) gnuOperands(tokens []LexToken) [][]LexToken {
+	var operands [][]LexToken
+	if len(tokens) == 0 {
+		return operands
+	}
+	nesting := 0
+	start := 0
+	for i, tok := range tokens {
+		switch tok.Token {
+		case '(':
+			nesting++
+		case ')':
+			nesting--
+		case ',':
+			if nesting == 0 {
+				operands = append(operands, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	operands = append(operands, tokens[start:])
+	nonEmpty := operands[:0]
+	for _, op := range operands {
+		if len(op) == 0 {
+			p.errorf("missing operand")
+			continue
+		}
+		nonEmpty = append(nonEmpty, op)
+	}
+	return nonEmpty
+}
+
+// gnuName returns the name in tokens, which must be foo or .Lfoo, in its Go form:
+// a local name loses its period and is static.
+func (p *Parser) gnuName(tokens []LexToken) (name string, static bool) {
+	switch {
+	case len(tokens) == 1 && tokens[0].Token == scanner.Ident:
+		return tokens[0].text, false
+	case len(tokens) == 2 && tokens[0].Token == '.' && tokens[1].Token == scanner.Ident:
+		return tokens[1].text, true
+	}
+	p.errorf("expected symbol name")
+	return "", false
+}
+
+// gnuSymbolName returns the Go name of the symbol, with <> if it is static.
+func gnuSymbolName(name string, static bool) string {
+	if static {
+		return name + "<>"
+	}
+	return name
+}
+
+// gnuLabel defines the label whose tokens, without the colon, are given.
+func (p *Parser) gnuLabel(tokens []LexToken) {
+	if tokens[0].Token == scanner.Int {
+		if p.gnu.section != "text" {
+			p.errorf("numeric label %s: outside .text", tokens[0].text)
+		}
+		word := tokens[0].text
+		p.numLabels[word]++
+		p.pendingLabels = append(p.pendingLabels, numericLabel(word, p.numLabels[word]))
+		p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "label %s:", word)
+		return
+	}
+	name, static := p.gnuName(tokens)
+	p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "label %s:", name)
+	switch p.gnu.section {
+	case "text":
+		if static || !p.gnu.globals[name] && !p.gnu.functions[name] && !p.gnu.called[name] {
+			p.gnu.labels[name] = true
+			p.pendingLabels = append(p.pendingLabels, name)
+			return
+		}
+		p.gnuEndData()
+		p.gnu.functions[name] = true
+		p.gnuPseudo("TEXT", "%s(SB), %d, $0", name, flagNOSPLIT)
+	case "data", "rodata", "bss":
+		p.gnuEndData()
+		p.gnu.data = &gnuData{name: gnuSymbolName(name, static)}
+		if p.gnu.section == "rodata" {
+			p.gnu.data.flags = flagRODATA
+		}
+	default:
+		p.errorf("label %s in section %s", name, p.gnu.section)
+	}
+}
+
+// gnuEndData finishes the data symbol being defined, if any, with its GLOBL.
+func (p *Parser) gnuEndData() {
+	d := p.gnu.data
+	if d == nil {
+		return
+	}
+	p.gnu.data = nil
+	flags := d.flags
+	if !d.hasAddr {
+		flags |= flagNOPTR
+	}
+	p.gnuPseudo("GLOBL", "%s(SB), %d, $%d", d.name, flags, d.size)
+}
+
+// gnuPseudo assembles the pseudo-op word with the operands given in the Go syntax.
+// The operands are attributed to the current statement for diagnostics.
+func (p *Parser) gnuPseudo(word, format string, args ...interface{}) {
+	var operands [][]LexToken
+	var operand []LexToken
+	for _, tok := range tokenize(fmt.Sprintf(format, args...)) {
+		tok.col = p.inst.col
+		if tok.Token == ',' {
+			operands = append(operands, operand)
+			operand = nil
+			continue
+		}
+		operand = append(operand, tok)
+	}
+	operands = append(operands, operand)
+	p.pseudo(p.arch.pseudos[word], word, operands)
+}
+
+// gnuSections maps the names of the sections the GNU dialect understands to their kinds.
+// A section whose name starts with one of these, such as .rodata.cst16, has the same kind.
+var gnuSections = []struct {
+	name, kind string
+}{
+	{".text", "text"},
+	{".data", "data"},
+	{".rodata", "rodata"},
+	{".bss", "bss"},
+	{".note.GNU-stack", "note"},
+}
+
+// gnuIgnored are the directives that have no effect on the Go object.
+var gnuIgnored = map[string]bool{
+	"att_syntax": true,
+	"file":       true,
+	"hidden":     true,
+	"ident":      true,
+	"internal":   true,
+	"loc":        true,
+	"protected":  true,
+	"size":       true,
+}
+
+// gnuDataSizes are the sizes of the directives that store integers.
+var gnuDataSizes = map[string]int{
+	"byte":  1,
+	"short": 2,
+	"value": 2,
+	"word":  2,
+	"hword": 2,
+	"long":  4,
+	"int":   4,
+	"quad":  8,
+}
+
+// gnuDirective assembles the directive .name.
+func (p *Parser) gnuDirective(name string, operands [][]LexToken) {
+	if gnuIgnored[name] || strings.HasPrefix(name, "cfi_") {
+		return
+	}
+	if size := gnuDataSizes[name]; size != 0 {
+		for _, op := range operands {
+			p.gnuDataValue(name, size, op)
+		}
+		return
+	}
+	switch name {
+	case "text", "data", "bss":
+		p.gnuSection(name, "."+name)
+	case "section":
+		if len(operands) == 0 {
+			p.errorf(".section needs a name")
+			return
+		}
+		var section string
+		for _, tok := range operands[0] {
+			section += tok.text
+		}
+		p.gnuSection("", section)
+	case "globl", "global":
+		for _, op := range operands {
+			if name, static := p.gnuName(op); !static {
+				p.gnu.globals[name] = true
+			}
+		}
+	case "type":
+		if len(operands) != 2 {
+			p.errorf(".type needs a name and a type")
+			return
+		}
+		name, _ := p.gnuName(operands[0])
+		switch typ := operands[1]; {
+		case len(typ) == 2 && (typ[0].Token == '@' || typ[0].Token == '%') && typ[1].text == "function",
+			len(typ) == 1 && typ[0].text == "STT_FUNC":
+			p.gnu.functions[name] = true
+		}
+	case "align", "balign", "p2align":
+		if len(operands) == 0 {
+			p.errorf(".%s needs an alignment", name)
+			return
+		}
+		align := p.gnuConstant(operands[0])
+		largest := int64(gnuMaxAlign)
+		if name == "p2align" {
+			largest = gnuMaxAlignLog
+		}
+		switch {
+		case align < 0 || align > largest:
+			p.errorf(".%s %d is out of range; the largest is %d", name, align, largest)
+			return
+		case name == "p2align":
+			align = 1 << uint(align)
+		case align == 0 || align&(align-1) != 0:
+			p.errorf(".%s %d is not a power of two", name, align)
+			return
+		}
+		if d := p.gnu.data; d != nil && align > 0 && p.gnu.section != "text" {
+			d.size = (d.size + align - 1) / align * align
+		}
+	case "zero", "skip", "space":
+		if len(operands) == 0 || len(operands) > 2 {
+			p.errorf(".%s needs a size", name)
+			return
+		}
+		if len(operands) == 2 && p.gnuConstant(operands[1]) != 0 {
+			p.errorf(".%s with a nonzero fill value is not supported", name)
+		}
+		size, ok := p.gnuSize(name, operands[0])
+		if !ok {
+			return
+		}
+		if d := p.gnuDataSymbol(name); d != nil {
+			d.size += size
+		}
+	case "ascii", "asciz", "string":
+		for _, op := range operands {
+			if len(op) != 1 || op[0].Token != scanner.String {
+				p.errorf(".%s needs strings", name)
+				return
+			}
+			s, err := strconv.Unquote(op[0].text)
+			if err != nil {
+				p.errorf(".%s: %s", name, err)
+			}
+			if name != "ascii" {
+				s += "\x00"
+			}
+			p.gnuDataString(name, s)
+		}
+	case "comm", "lcomm":
+		if len(operands) < 2 {
+			p.errorf(".%s needs a name and a size", name)
+			return
+		}
+		sym, static := p.gnuName(operands[0])
+		size, ok := p.gnuSize(name, operands[1])
+		if !ok {
+			return
+		}
+		p.gnuEndData()
+		p.gnuPseudo("GLOBL", "%s(SB), %d, $%d", gnuSymbolName(sym, static), 0, size)
+	case "intel_syntax":
+		p.errorf("Intel syntax is not supported; only AT&T syntax can be read")
+	default:
+		p.errorf("unsupported directive .%s", name)
+	}
+}
+
+// gnuSection switches to the named section. The kind is given for .text,
+// .data and .bss, and otherwise found from the name.
+func (p *Parser) gnuSection(kind, name string) {
+	for _, s := range gnuSections {
+		if kind == "" && (name == s.name || strings.HasPrefix(name, s.name+".")) {
+			kind = s.kind
+		}
+	}
+	if kind == "" {
+		p.errorf("unsupported section %s", name)
+	}
+	p.gnuEndData()
+	p.gnu.section = kind
+}
+
+// gnuDataSymbol returns the data symbol that the directive adds to.
+// If there is none, it reports the error and returns nil.
+func (p *Parser) gnuDataSymbol(directive string) *gnuData {
+	switch {
+	case p.gnu.section == "text":
+		p.errorf(".%s in .text is not supported; move the data to .rodata", directive)
+	case p.gnu.data == nil:
+		p.errorf(".%s outside a data symbol; put a label before it", directive)
+	default:
+		return p.gnu.data
+	}
+	return nil
+}
+
+// gnuDataValue stores the integer or address in operand as the next size bytes of the data symbol.
+func (p *Parser) gnuDataValue(directive string, size int, operand []LexToken) {
+	d := p.gnuDataSymbol(directive)
+	if d == nil {
+		return
+	}
+	if operand[0].Token == scanner.Ident || operand[0].Token == '.' {
+		a, _ := p.gnuOperand(operand)
+		if !a.is(addrSymbol|addrRegister|addrIndirect) && !a.is(addrSymbol|addrRegister|addrIndirect|addrOffset) {
+			p.errorf(".%s: expected symbol or constant", directive)
+		}
+		if size != p.gnuPtrSize() {
+			p.errorf(".%s cannot hold an address; use .%s", directive, map[int]string{4: "long", 8: "quad"}[p.gnuPtrSize()])
+		}
+		d.hasAddr = true
+		p.gnuPseudo("DATA", "%s+%d(SB)/%d, $%s%+d(SB)", d.name, d.size, size, gnuSymbolName(a.symbol, a.isStatic), a.offset)
+	} else {
+		p.gnuPseudo("DATA", "%s+%d(SB)/%d, $%d", d.name, d.size, size, p.gnuConstant(operand))
+	}
+	d.size += int64(size)
+}
+
+// gnuDataString stores the string as the next bytes of the data symbol,
+// in pieces of the sizes DATA allows.
+func (p *Parser) gnuDataString(directive, s string) {
+	d := p.gnuDataSymbol(directive)
+	if d == nil {
+		return
+	}
+	for len(s) > 0 {
+		n := 8
+		for n > len(s) {
+			n /= 2
+		}
+		p.gnuPseudo("DATA", "%s+%d(SB)/%d, $%s", d.name, d.size, n, strconv.Quote(s[:n]))
+		d.size += int64(n)
+		s = s[n:]
+	}
+}
+
+// gnuConstant evaluates the operand, which must be a constant expression.
+func (p *Parser) gnuConstant(operand []LexToken) int64 {
+	p.start(operand)
+	v := int64(p.expr())
+	p.expect(scanner.EOF)
+	return v
+}
+
+// gnuSize evaluates the operand of the directive, a size in bytes. It reports
+// whether the size is valid: a negative size would shrink the symbol.
+func (p *Parser) gnuSize(directive string, operand []LexToken) (int64, bool) {
+	size := p.gnuConstant(operand)
+	if size < 0 {
+		p.errorf(".%s size %d is negative", directive, size)
+		return 0, false
+	}
+	return size, true
+}
+
+// The largest alignment .align and .balign accept, and its log for .p2align.
+// A data symbol is padded to the alignment, so a larger one is surely a mistake.
+const (
+	gnuMaxAlignLog = 12
+	gnuMaxAlign    = 1 << gnuMaxAlignLog
+)
+
+func (p *Parser) gnuPtrSize() int {
+	if p.arch.Thechar == '6' {
+		return 8
+	}
+	return 4
+}
+
+// gnuPrefixes maps the instruction prefixes to their Go instructions.
+var gnuPrefixes = map[string]string{
+	"lock":  "LOCK",
+	"rep":   "REP",
+	"repe":  "REP",
+	"repz":  "REP",
+	"repne": "REPN",
+	"repnz": "REPN",
+}
+
+// gnuConditions maps the condition suffixes of jcc, setcc and cmovcc to Go's.
+var gnuConditions = map[string]string{
+	"e": "EQ", "z": "EQ",
+	"ne": "NE", "nz": "NE",
+	"l": "LT", "nge": "LT",
+	"le": "LE", "ng": "LE",
+	"g": "GT", "nle": "GT",
+	"ge": "GE", "nl": "GE",
+	"b": "CS", "c": "CS", "nae": "CS",
+	"ae": "CC", "nb": "CC", "nc": "CC",
+	"be": "LS", "na": "LS",
+	"a": "HI", "nbe": "HI",
+	"s": "MI", "ns": "PL",
+	"o": "OS", "no": "OC",
+	"p": "PS", "pe": "PS",
+	"np": "PC", "po": "PC",
+}
+
+// gnuMnemonics maps the AT&T mnemonics that Go spells differently.
+// Conditional instructions are handled by gnuConditional.
+var gnuMnemonics = map[string]string{
+	"jmpq":    "JMP",
+	"call":    "CALL",
+	"callq":   "CALL",
+	"calll":   "CALL",
+	"retq":    "RET",
+	"retl":    "RET",
+	"movabs":  "MOVQ",
+	"movabsq": "MOVQ",
+	"movzbw":  "MOVBWZX",
+	"movzbl":  "MOVBLZX",
+	"movzbq":  "MOVBQZX",
+	"movzwl":  "MOVWLZX",
+	"movzwq":  "MOVWQZX",
+	"movsbw":  "MOVBWSX",
+	"movsbl":  "MOVBLSX",
+	"movsbq":  "MOVBQSX",
+	"movswl":  "MOVWLSX",
+	"movswq":  "MOVWQSX",
+	"movslq":  "MOVLQSX",
+	"movd":    "MOVL",
+	"movdqa":  "MOVO",
+	"movdqu":  "MOVOU",
+	"pshufd":  "PSHUFL",
+	"cbtw":    "CBW",
+	"cwtd":    "CWD",
+	"cltd":    "CDQ",
+	"cqto":    "CQO",
+	"shld":    "SHL",
+	"shldw":   "SHLW",
+	"shldl":   "SHLL",
+	"shldq":   "SHLQ",
+	"shrd":    "SHR",
+	"shrdw":   "SHRW",
+	"shrdl":   "SHRL",
+	"shrdq":   "SHRQ",
+}
+
+// gnuUnsupported are instructions whose Go form differs in ways the translation
+// cannot be sure of, so they must be translated by hand.
+var gnuUnsupported = map[string]bool{
+	"cmppd": true,
+	"cmpps": true,
+	"cmpsd": true,
+	"cmpss": true,
+}
+
+var gnuSuffixes = map[int]string{1: "B", 2: "W", 4: "L", 8: "Q"}
+
+// gnuConditional returns the Go form of a conditional instruction: jcc,
+// setcc or cmovcc, the last with an optional size suffix.
+func gnuConditional(word string, size int) string {
+	switch {
+	case strings.HasPrefix(word, "j") && gnuConditions[word[1:]] != "":
+		return "J" + gnuConditions[word[1:]]
+	case strings.HasPrefix(word, "set") && gnuConditions[word[3:]] != "":
+		return "SET" + gnuConditions[word[3:]]
+	case strings.HasPrefix(word, "cmov"):
+		cond := word[4:]
+		if gnuConditions[cond] == "" && len(cond) > 1 {
+			// cmovneq: the suffix gives the size. cmovl is cmov if less.
+			for n, s := range gnuSuffixes {
+				if strings.ToLower(s) == cond[len(cond)-1:] {
+					cond, size = cond[:len(cond)-1], n
+				}
+			}
+		}
+		if gnuConditions[cond] != "" && gnuSuffixes[size] != "" {
+			return "CMOV" + gnuSuffixes[size] + gnuConditions[cond]
+		}
+	}
+	return ""
+}
+
+// gnuMnemonic returns the Go instruction for the AT&T mnemonic, which has n
+// operands. Size is the size in bytes of the register operands, or zero if
+// that is not known; it supplies the suffix a mnemonic such as mov leaves off.
+func (p *Parser) gnuMnemonic(word string, n, size int) string {
+	if gnuUnsupported[word] {
+		p.errorf("%s is not supported; translate it by hand", word)
+	}
+	if name := gnuConditional(word, size); name != "" {
+		return name
+	}
+	name, ok := gnuMnemonics[word]
+	if !ok {
+		name = strings.ToUpper(word)
+	}
+	if strings.HasPrefix(name, "IMUL") && n == 3 {
+		name = "IMUL3" + name[len("IMUL"):]
+	}
+	if p.arch.instructions[name] != 0 {
+		return name
+	}
+	if suffix := gnuSuffixes[size]; suffix != "" && p.arch.instructions[name+suffix] != 0 {
+		return name + suffix
+	}
+	if size == 0 && p.arch.instructions[name+"L"] != 0 {
+		p.errorf("%s: cannot tell the operand size; add a b, w, l or q suffix", word)
+	}
+	p.errorf("unrecognized instruction %s", word)
+	return ""
+}
+
+// gnuInstruction assembles the instruction word, with its operands in AT&T order.
+func (p *Parser) gnuInstruction(word string, operands [][]LexToken) {
+	if prefix := gnuPrefixes[word]; prefix != "" {
+		p.asmInstruction(p.arch.instructions[prefix], prefix, nil)
+		return
+	}
+	jump := strings.HasPrefix(word, "j") || strings.HasPrefix(word, "call")
+	var addr []Addr
+	size := 0
+	for i, op := range operands {
+		if jump && i == len(operands)-1 {
+			// The target of a jump is a label, a function, or *operand.
+			op = p.numericTarget(op)
+			if op[0].Token == '*' {
+				op = op[1:]
+			} else if len(op) == 1 && op[0].Token == scanner.Ident || len(op) == 2 && op[0].Token == '.' {
+				addr = append(addr, p.gnuTarget(word, op))
+				continue
+			}
+		}
+		a, s := p.gnuOperand(op)
+		if s > size {
+			size = s
+		}
+		addr = append(addr, a)
+	}
+	p.at = p.inst
+	name := p.gnuMnemonic(word, len(operands), size)
+	if name == "" {
+		return
+	}
+	op := p.arch.instructions[name]
+	if p.arch.jumps[name] {
+		p.asmJump(op, addr)
+		return
+	}
+	switch {
+	case len(addr) == 2 && (name == "CMPB" || name == "CMPW" || name == "CMPL" || name == "CMPQ"):
+		// cmpq %rax, %rbx sets the flags from rbx-rax; Go's CMPQ compares in the order written.
+		addr[0], addr[1] = addr[1], addr[0]
+	case len(addr) >= 2 && gnuShift(name) && addr[0].is(addrRegister) && addr[0].register == p.arch.registers["CL"]:
+		// The count of a shift is %cl, which Go writes as CX.
+		addr[0].register = p.arch.registers["CX"]
+	}
+	p.asmInstruction(op, name, addr)
+}
+
+// gnuShift reports whether the instruction is a shift or rotate, whose count may be in CX.
+func gnuShift(name string) bool {
+	for _, s := range []string{"SHL", "SHR", "SAL", "SAR", "ROL", "ROR", "RCL", "RCR"} {
+		if strings.HasPrefix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// gnuTarget returns the target of a jump or call written as a name. A call, and a
+// jump to a function, go to the symbol; other jumps go to the label. A label that
+// is called later starts a TEXT, but one already defined within a function cannot.
+func (p *Parser) gnuTarget(word string, tokens []LexToken) Addr {
+	name, static := p.gnuName(tokens)
+	if !static && strings.HasPrefix(word, "call") {
+		if p.gnu.labels[name] {
+			p.errorf("call to label %s, which is not a function; declare it with .type %s, @function before the label", name, name)
+		}
+		p.gnu.called[name] = true
+	}
+	if !static && (strings.HasPrefix(word, "call") || p.gnu.functions[name] || p.gnu.globals[name]) {
+		return Addr{symbol: name, isIndirect: true, hasRegister: true, register: rSB}
+	}
+	return Addr{symbol: name}
+}
+
+// gnuOperand parses an AT&T operand. It returns the Addr, and the size in bytes
+// of the operand if it is a general register, or zero.
+func (p *Parser) gnuOperand(operand []LexToken) (Addr, int) {
+	p.start(operand)
+	a := Addr{at: p.at}
+	size := 0
+	switch p.peek() {
+	case '%':
+		a.hasRegister = true
+		a.register, size = p.gnuRegister()
+		if p.peek() == ':' {
+			p.errorf("segment override is not supported")
+		}
+	case '$':
+		p.next()
+		if p.gnuSymbol(&a) {
+			// $sym: the address of the symbol.
+			a.isImmediateAddress = true
+			a.isIndirect = true
+			a.hasRegister = true
+			a.register = rSB
+		} else {
+			a.isImmediateConstant = true
+			a.hasOffset = true
+			a.offset = int64(p.expr())
+		}
+	default:
+		p.gnuMemory(&a)
+	}
+	p.expect(scanner.EOF)
+	return a, size
+}
+
+// gnuSymbol parses a symbol and its optional offset, sym+8, into a, and reports
+// whether there was one.
+func (p *Parser) gnuSymbol(a *Addr) bool {
+	switch {
+	case p.peek() == scanner.Ident:
+		a.symbol = p.next().text
+	case p.peek() == '.' && p.gnuPeek(1).Token == scanner.Ident:
+		p.next()
+		a.symbol = p.next().text
+		a.isStatic = true
+	default:
+		return false
+	}
+	switch p.peek() {
+	case '@':
+		p.errorf("%s@%s is not supported", a.symbol, p.gnuPeek(1).text)
+	case '+', '-':
+		a.hasOffset = true
+		a.offset = int64(p.expr())
+	}
+	return true
+}
+
+// gnuMemory parses a memory operand: disp(base,index,scale), any part of
+// which may be missing, where disp is a constant or a symbol with an offset.
+func (p *Parser) gnuMemory(a *Addr) {
+	if !p.gnuSymbol(a) && !p.gnuParenRegister() {
+		a.hasOffset = true
+		a.offset = int64(p.expr())
+	}
+	if p.peek() == scanner.EOF {
+		if a.symbol != "" {
+			// sym: an absolute reference, sym(SB).
+			a.isIndirect = true
+			a.hasRegister = true
+			a.register = rSB
+		}
+		// Otherwise a constant, an absolute address as in Go.
+		return
+	}
+	p.get('(')
+	a.isIndirect = true
+	base, rip := 0, false
+	if p.peek() == '%' {
+		if p.gnuPeek(1).text == "rip" {
+			p.next()
+			p.next()
+			rip = true
+		} else {
+			base, _ = p.gnuRegister()
+		}
+	}
+	if p.peek() == ',' {
+		p.next()
+		if p.peek() == '%' {
+			a.index, _ = p.gnuRegister()
+			a.scale = 1
+		}
+		if p.peek() == ',' {
+			p.next()
+			a.scale = p.scale(p.get(scanner.Int).text)
+		}
+	}
+	p.get(')')
+	switch {
+	case rip:
+		if a.symbol == "" || a.index != 0 {
+			p.errorf("%%rip-relative operand must be sym(%%rip)")
+		}
+		a.hasRegister = true
+		a.register = rSB
+	case a.symbol != "" && base != 0:
+		p.errorf("%s with a base register is not supported; use %s(%%rip) and a register", a.symbol, a.symbol)
+	case a.symbol != "":
+		a.hasRegister = true
+		a.register = rSB
+	case base != 0:
+		a.hasRegister = true
+		a.register = base
+	}
+}
+
+// gnuParenRegister reports whether the next tokens start a register in parentheses, (%,
+// or an index with no base, (,. Otherwise a parenthesis starts an expression.
+func (p *Parser) gnuParenRegister() bool {
+	next := p.gnuPeek(1).Token
+	return p.peek() == '(' && (next == '%' || next == ',')
+}
+
+// gnuPeek returns the token n places after the next one, without consuming anything.
+func (p *Parser) gnuPeek(n int) LexToken {
+	if i := p.inputPos + n; i < len(p.input) {
+		return p.input[i]
+	}
+	return end
+}
+
+// gnuRegister parses a register, %rax, and returns the Go register and its
+// size in bytes if it is a general register, or zero.
+func (p *Parser) gnuRegister() (int, int) {
+	p.get('%')
+	tok := p.get(scanner.Ident)
+	gnuName := strings.ToLower(tok.text)
+	if gnuName == "st" {
+		p.errorf("x87 register %%%s is not supported", tok.text)
+	}
+	name, size := gnuRegisterName(gnuName)
+	r, ok := p.arch.registers[name]
+	if name == "" || !ok {
+		p.errorf("unknown register %%%s", tok.text)
+	}
+	return r, size
+}
+
+// gnuRegisters maps the general registers to their Go names and sizes.
+var gnuRegisters = make(map[string]struct {
+	name string
+	size int
+})
+
+func init() {
+	add := func(gnu, name string, size int) {
+		gnuRegisters[gnu] = struct {
+			name string
+			size int
+		}{name, size}
+	}
+	for _, r := range "abcd" {
+		x := string(r)
+		X := strings.ToUpper(x)
+		add("r"+x+"x", X+"X", 8)
+		add("e"+x+"x", X+"X", 4)
+		add(x+"x", X+"X", 2)
+		add(x+"l", X+"L", 1)
+		add(x+"h", X+"H", 1)
+	}
+	for _, r := range []string{"sp", "bp", "si", "di"} {
+		R := strings.ToUpper(r)
+		add("r"+r, R, 8)
+		add("e"+r, R, 4)
+		add(r, R, 2)
+		add(r+"l", R+"B", 1)
+	}
+	for i := 8; i < 16; i++ {
+		r := fmt.Sprintf("r%d", i)
+		R := strings.ToUpper(r)
+		add(r, R, 8)
+		add(r+"d", R, 4)
+		add(r+"w", R, 2)
+		add(r+"b", R+"B", 1)
+		add(r+"l", R+"B", 1)
+	}
+	for _, r := range []string{"cs", "ds", "es", "fs", "gs", "ss"} {
+		add(r, strings.ToUpper(r), 0)
+	}
+}
+
+// gnuRegisterName returns the Go name of the register and, if it is a general
+// register, its size in bytes.
+func gnuRegisterName(name string) (string, int) {
+	if r, ok := gnuRegisters[name]; ok {
+		return r.name, r.size
+	}
+	switch {
+	case numbered(name, "xmm"):
+		return "X" + name[3:], 0
+	case numbered(name, "mm"):
+		return "M" + name[2:], 0
+	case numbered(name, "cr"), numbered(name, "dr"):
+		return strings.ToUpper(name), 0
+	}
+	return "", 0
+}
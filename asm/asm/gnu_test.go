@@ -0,0 +1,212 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Each GNU source must assemble to the same program as its Go translation.
+var gnuTests = []struct {
+	name        string
+	gnu         string
+	translation string
+}{
+	{
+		"function",
+		"# A comment line.\n" +
+			"\t.text\n" +
+			"\t.globl f\n" +
+			"\t.type f, @function\n" +
+			"f:\n" +
+			"\tmovq 8(%rsp), %rax # the argument, isn't it\n" +
+			"\taddq $1, %rax\n" +
+			"\tmovq %rax, 16(%rsp)\n" +
+			"\tret\n" +
+			"\t.size f, .-f\n",
+		"TEXT f(SB), 4, $0\n" +
+			"MOVQ 8(SP), AX\n" +
+			"ADDQ $1, AX\n" +
+			"MOVQ AX, 16(SP)\n" +
+			"RET\n",
+	},
+	{
+		"local function",
+		".globl f\n" +
+			"f:\n" +
+			"\tcall helper\n" +
+			"\tret\n" +
+			"helper:\n" +
+			"\tret\n",
+		"TEXT f(SB), 4, $0\n" +
+			"CALL helper(SB)\n" +
+			"RET\n" +
+			"TEXT helper(SB), 4, $0\n" +
+			"RET\n",
+	},
+	{
+		"addressing",
+		".globl f\n" +
+			"f:\n" +
+			"movl (%rax,%rbx,4), %ecx\n" +
+			"leaq tab(%rip), %rdx\n" +
+			"movq tab+8(,%rcx,8), %rax\n" +
+			"mov %eax, %ebx\n" +
+			"cmpq $0, %rax\n" +
+			"jne .Ldone\n" +
+			"shlq %cl, %rdx\n" +
+			".Ldone:\n" +
+			"ret\n",
+		"TEXT f(SB), 4, $0\n" +
+			"MOVL (AX)(BX*4), CX\n" +
+			"LEAQ tab(SB), DX\n" +
+			"MOVQ tab+8(SB)(CX*8), AX\n" +
+			"MOVL AX, BX\n" +
+			"CMPQ AX, $0\n" +
+			"JNE Ldone\n" +
+			"SHLQ CX, DX\n" +
+			"Ldone:\n" +
+			"RET\n",
+	},
+	{
+		"control",
+		".type g, @function\n" +
+			"g:\n" +
+			"1: decq %rcx\n" +
+			"jnz 1b\n" +
+			"sete %al\n" +
+			"cmovneq %rbx, %rax\n" +
+			"lock; xaddl %eax, (%rbx)\n" +
+			"movzbl (%rsi), %eax\n" +
+			"imul $3, %rax, %rbx\n" +
+			"push %rbp\n" +
+			"call runtime_foo\n" +
+			"jmp *%rax\n",
+		"TEXT g(SB), 4, $0\n" +
+			"a: DECQ CX\n" +
+			"JNE a\n" +
+			"SETEQ AL\n" +
+			"CMOVQNE BX, AX\n" +
+			"LOCK\n" +
+			"XADDL AX, (BX)\n" +
+			"MOVBLZX (SI), AX\n" +
+			"IMUL3Q $3, AX, BX\n" +
+			"PUSHQ BP\n" +
+			"CALL runtime_foo(SB)\n" +
+			"JMP AX\n",
+	},
+	{
+		"data",
+		"\t.section .rodata\n" +
+			"\t.align 16\n" +
+			".Lconst:\n" +
+			"\t.quad 1, 2\n" +
+			"\t.long 3\n" +
+			"\t.byte 4, -1\n" +
+			"\t.data\n" +
+			"\t.globl ptrs\n" +
+			"ptrs:\n" +
+			"\t.quad .Lconst\n" +
+			"\t.quad ptrs+8\n" +
+			"\t.bss\n" +
+			"buf:\n" +
+			"\t.zero 64\n" +
+			"\t.section .rodata.str1.1,\"aMS\",@progbits,1\n" +
+			"msg:\n" +
+			"\t.asciz \"hello, world\"\n" +
+			"\t.section .note.GNU-stack,\"\",@progbits\n",
+		"DATA Lconst<>+0(SB)/8, $1\n" +
+			"DATA Lconst<>+8(SB)/8, $2\n" +
+			"DATA Lconst<>+16(SB)/4, $3\n" +
+			"DATA Lconst<>+20(SB)/1, $4\n" +
+			"DATA Lconst<>+21(SB)/1, $-1\n" +
+			"GLOBL Lconst<>(SB), 24, $22\n" +
+			"DATA ptrs+0(SB)/8, $Lconst<>+0(SB)\n" +
+			"DATA ptrs+8(SB)/8, $ptrs+8(SB)\n" +
+			"GLOBL ptrs(SB), 0, $16\n" +
+			"GLOBL buf(SB), 16, $64\n" +
+			"DATA msg+0(SB)/8, $\"hello, w\"\n" +
+			"DATA msg+8(SB)/4, $\"orld\"\n" +
+			"DATA msg+12(SB)/1, $\"\\x00\"\n" +
+			"GLOBL msg(SB), 24, $13\n",
+	},
+}
+
+func TestGNU(t *testing.T) {
+	for _, test := range gnuTests {
+		var buf bytes.Buffer
+		opts := Options{Dialect: DialectGNU, List: &buf}
+		obj, diags := Assemble("amd64", "x.s", strings.NewReader(test.gnu), opts)
+		if obj == nil {
+			t.Errorf("%s: %v", test.name, diags)
+			continue
+		}
+		want := list(t, "amd64", "x.s", []byte(test.translation))
+		if buf.String() != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, buf.String(), want)
+		}
+	}
+}
+
+var gnuErrorTests = []struct {
+	arch string
+	src  string
+	msg  string
+}{
+	{"amd64", "movq %fs:0, %rax", "segment override is not supported"},
+	{"amd64", "fld %st(1)", "x87 register %st is not supported"},
+	{"amd64", "movq foo(%rax), %rbx", "foo with a base register is not supported; use foo(%rip) and a register"},
+	{"amd64", "movq 8(%rip), %rbx", "%rip-relative operand must be sym(%rip)"},
+	{"amd64", "mov $1, (%rax)", "mov: cannot tell the operand size; add a b, w, l or q suffix"},
+	{"amd64", "cmpps $1, %xmm0, %xmm1", "cmpps is not supported; translate it by hand"},
+	{"amd64", "call foo@PLT", "foo@PLT is not supported"},
+	{"amd64", "frobq %rax", "unrecognized instruction frobq"},
+	{"amd64", "helper:\n\tret\n\tcall helper", "call to label helper, which is not a function; declare it with .type helper, @function before the label"},
+	{"amd64", ".intel_syntax noprefix", "Intel syntax is not supported; only AT&T syntax can be read"},
+	{"amd64", ".macro twice", "unsupported directive .macro"},
+	{"amd64", ".section .init_array", "unsupported section .init_array"},
+	{"amd64", ".quad 1", ".quad in .text is not supported; move the data to .rodata"},
+	{"amd64", ".data\n.quad 1", ".quad outside a data symbol; put a label before it"},
+	{"amd64", ".data\nx: .long y", ".long cannot hold an address; use .quad"},
+	{"amd64", ".data\nx: .zero -5", ".zero size -5 is negative"},
+	{"amd64", ".comm c, -8", ".comm size -8 is negative"},
+	{"amd64", ".data\nx: .byte 1\n.p2align 99", ".p2align 99 is out of range; the largest is 12"},
+	{"amd64", ".data\nx: .byte 1\n.align 12", ".align 12 is not a power of two"},
+	{"amd64", ".data\nx: .byte 1\n.balign 8192", ".balign 8192 is out of range; the largest is 4096"},
+	{"386", "movl %r8d, %eax", "unknown register %r8d"},
+	{"arm", "mov r0, r1", "the GNU dialect is supported only on 386 and amd64, not arm"},
+}
+
+func TestGNUErrors(t *testing.T) {
+	for _, test := range gnuErrorTests {
+		src := ".globl f\nf:\n" + test.src + "\n"
+		_, diags := Assemble(test.arch, "x.s", strings.NewReader(src), Options{Dialect: DialectGNU})
+		if len(diags) == 0 || diags[0].Msg != test.msg {
+			t.Errorf("%s: got %v; want %q", test.src, diags, test.msg)
+		}
+	}
+}
+
+func TestGNUOutsideFunction(t *testing.T) {
+	src := "\t.text\nf:\n\tret\n"
+	want := "x.s:3:2: instruction outside of function"
+	_, diags := Assemble("amd64", "x.s", strings.NewReader(src), Options{Dialect: DialectGNU})
+	if len(diags) == 0 || diags[0].String() != want {
+		t.Errorf("got %v; want %q", diags, want)
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	for _, d := range []Dialect{DialectGo, DialectGNU} {
+		if got, err := ParseDialect(d.String()); got != d || err != nil {
+			t.Errorf("ParseDialect(%q) = %v, %v", d, got, err)
+		}
+	}
+	if _, err := ParseDialect("intel"); err == nil {
+		t.Error("ParseDialect(\"intel\") succeeded")
+	}
+}
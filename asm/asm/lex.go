@@ -0,0 +1,1613 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm // TODO: package lex
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+// A Token represents an input item. It is a simple wrapping of rune, as
+// returned by text/scanner.Scanner, plus a couple of extra values.
+type Token rune
+
+const (
+	// Asm defines some two-character lexemes. We make up
+	// a rune/Token value for them - ugly but simple.
+	LSH Token = -1000 - iota // << Left shift.
+	RSH                      // >> Logical right shift.
+	ARR                      // -> Used on ARM for shift type 3, arithmetic right shift.
+	ROT                      // -> Used on ARM for shift type 4, rotate right.
+)
+
+func (t Token) String() string {
+	switch t {
+	case scanner.EOF:
+		return "EOF"
+	case scanner.Ident:
+		return "identifier"
+	case scanner.Int:
+		return "integer constant"
+	case scanner.Float:
+		return "float constant"
+	case scanner.Char:
+		return "rune constant"
+	case scanner.String:
+		return "string constant"
+	case scanner.RawString:
+		return "raw string constant"
+	case scanner.Comment:
+		return "comment"
+	default:
+		return fmt.Sprintf("%q", rune(t))
+	}
+}
+
+// NewLexer returns a TokenReader for the named source, read from r, with the macro
+// definitions, include directories and file system of opts applied. The line history
+// is recorded in ctxt and errors in the input are reported to diag.
+func NewLexer(name string, r io.Reader, ctxt *liblink.Link, diag *Diagnostics, opts *Options) *Input {
+	hist := &lineHistory{
+		ctxt:     ctxt,
+		line:     1,
+		trimPath: opts.TrimPath,
+	}
+	input := NewInput(name, diag, hist, opts.Defines, opts.IncludeDirs)
+	input.trace = newTracer(opts)
+	input.hashComments = opts.Dialect == DialectGNU
+	if opts.FS != nil {
+		input.fs = opts.FS
+	}
+	input.goos, input.goarch = opts.GOOS, opts.GOARCH
+	t := NewTokenizer(name, r, hist)
+	t.path = filepath.Clean(name)
+	t.hashComments = input.hashComments
+	t.s.Error = input.scanError(t)
+	input.Push(t)
+	return input
+}
+
+// A lineHistory tracks the position in the concatenation of all the input files, and records
+// in the link context where each file starts, so positions in the object can be mapped back
+// to the source.
+type lineHistory struct {
+	ctxt     *liblink.Link
+	line     int    // Line number counting across all input files.
+	trimPath string // Prefix removed from recorded file names.
+}
+
+// record notes in the line history that the named file starts at the current
+// input line, or that #line has set the position to line. The trimPath prefix
+// is removed from the name so object files do not record build-machine paths.
+func (h *lineHistory) record(name string, line int) {
+	if h == nil {
+		// tokenize runs without a line history.
+		return
+	}
+	liblink.Linklinehist(h.ctxt, h.line, trimmedPath(name, h.trimPath), line)
+}
+
+// pop notes in the line history that an included file has ended.
+func (h *lineHistory) pop() {
+	if h == nil {
+		return
+	}
+	liblink.Linklinehist(h.ctxt, h.line, "XXXXXXX", 0) // TODO: what to do here?
+}
+
+// A TokenReader is like a reader, but returns lex tokens of type Token. It also can tell you what
+// the text of the most recently returned token is, and where it was found.
+// The underlying scanner elides all spaces except newline, so the input looks like a  stream of
+// Tokens; original spacing is lost but we don't need it.
+type TokenReader interface {
+	// Next returns the next token.
+	Next() Token
+	// The following methods all refer to the most recent token returned by Next.
+	// Text returns the original string representation of the token.
+	Text() string
+	// FileName reports the source file name of the token.
+	FileName() string
+	// Line reports the source line number of the token.
+	Line() int
+	// Col reports the column of the token, counting from 1, or 0 if it is not known.
+	// A token produced by a macro has the position of the macro invocation.
+	Col() int
+	// Expansion describes the macro expansions that produced the token, such as
+	// "in expansion of FOO defined at x.h:12", or is empty if the token is from the source.
+	Expansion() string
+	// SetPos sets the file and line number.
+	SetPos(line int, file string)
+}
+
+// A LexToken is a token and its string value.
+// A macro is stored as a sequence of LexTokens with spaces stripped.
+// Tokens read by the Parser also record where they came from.
+type LexToken struct {
+	Token
+	text string
+	col  int        // Column, as for TokenReader.Col.
+	exp  string     // Macro expansions that produced the token, as for TokenReader.Expansion.
+	hide *expansion // Macros whose expansion produced the token, which it does not invoke again.
+}
+
+// An expansion records that tokens came from expanding a macro.
+type expansion struct {
+	macro *Macro
+	outer *expansion // The expansion that produced the invocation, if any.
+	desc  string     // Cached result of String.
+}
+
+func (e *expansion) String() string {
+	if e == nil {
+		return ""
+	}
+	if e.desc == "" {
+		e.desc = fmt.Sprintf("in expansion of %s defined at %s:%d", e.macro.name, e.macro.file, e.macro.line)
+		if e.outer != nil {
+			e.desc += ", " + e.outer.String()
+		}
+	}
+	return e.desc
+}
+
+// contains reports whether the named macro is in the chain of expansions.
+func (e *expansion) contains(name string) bool {
+	for ; e != nil; e = e.outer {
+		if e.macro.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (l LexToken) String() string {
+	return l.text
+}
+
+// A Macro represents the definition of a #defined macro.
+type Macro struct {
+	name     string
+	args     []string // Formal arguments; nil if the macro takes no arguments.
+	variadic bool     // The last formal is __VA_ARGS__, matching any remaining arguments.
+	tokens   []LexToken
+	file     string // Where the macro was defined, for error messages.
+	line     int
+}
+
+// site returns a description of where the macro was defined.
+func (m *Macro) site() string {
+	if m.line == 0 {
+		return fmt.Sprintf("macro %s defined on %s", m.name, m.file)
+	}
+	return fmt.Sprintf("macro %s defined at %s:%d", m.name, m.file, m.line)
+}
+
+// tokenize turns a string into a list of LexTokens; used to parse the -D flag.
+func tokenize(str string) []LexToken {
+	tokens, _ := scanTokens(str)
+	return tokens
+}
+
+// scanTokens is like tokenize but also reports whether the string is made of
+// well-formed tokens: an unterminated string or character literal is not.
+func scanTokens(str string) (tokens []LexToken, ok bool) {
+	t := NewTokenizer("command line", strings.NewReader(str), nil)
+	ok = true
+	t.s.Error = func(*scanner.Scanner, string) { ok = false }
+	for {
+		tok := t.Next()
+		if tok == scanner.EOF {
+			break
+		}
+		tokens = append(tokens, LexToken{Token: tok, text: t.Text()})
+	}
+	return tokens, ok
+}
+
+// The rest of this file is implementations of TokenReader.
+
+// A Tokenizer is a simple wrapping of text/scanner.Scanner, configured
+// for our purposes and made a TokenReader. It forms the lowest level,
+// turning text from readers into tokens.
+type Tokenizer struct {
+	tok      Token
+	s        *scanner.Scanner
+	line     int
+	col      int
+	fileName string
+	path     string       // Cleaned path of the file, as opened, for detecting #include cycles.
+	hist     *lineHistory // May be nil.
+	// hashComments makes a # that is not first on its line start a comment, as in the GNU dialect.
+	hashComments bool
+}
+
+// NewTokenizer returns a Tokenizer reading the named source from r. If hist is not nil,
+// the file is recorded in the line history, and advances it as it is read.
+func NewTokenizer(name string, r io.Reader, hist *lineHistory) *Tokenizer {
+	var s scanner.Scanner
+	s.Init(r)
+	// Newline is like a semicolon; other space characters are fine.
+	s.Whitespace = 1<<'\t' | 1<<'\r' | 1<<' '
+	// Don't skip comments: we need to count newlines.
+	s.Mode = scanner.ScanChars |
+		scanner.ScanFloats |
+		scanner.ScanIdents |
+		scanner.ScanInts |
+		scanner.ScanStrings |
+		scanner.ScanComments
+	s.Position.Filename = name
+	s.IsIdentRune = isIdentRune
+	hist.record(name, 0)
+	return &Tokenizer{
+		s:        &s,
+		line:     1,
+		fileName: name,
+		hist:     hist,
+	}
+}
+
+// trimmedPath returns name with the directory prefix removed. Relative names are
+// made absolute first, as that is how they would otherwise be recorded.
+// Names outside prefix are returned unchanged.
+func trimmedPath(name, prefix string) string {
+	if prefix == "" {
+		return name
+	}
+	abs := name
+	if !filepath.IsAbs(abs) {
+		var err error
+		abs, err = filepath.Abs(abs)
+		if err != nil {
+			return name
+		}
+	}
+	prefix = filepath.Clean(prefix)
+	if strings.HasPrefix(abs, prefix+string(filepath.Separator)) {
+		return abs[len(prefix)+1:]
+	}
+	return name
+}
+
+// We want center dot (·) and division slash (∕) to work as identifier characters.
+func isIdentRune(ch rune, i int) bool {
+	if unicode.IsLetter(ch) {
+		return true
+	}
+	switch ch {
+	case '_': // Underscore; traditional.
+		return true
+	case '\u00B7': // Represents the period in runtime.exit.
+		return true
+	case '\u2215': // Represents the slash in runtime/debug.setGCPercent
+		return true
+	}
+	// Digits are OK only after the first character.
+	return i > 0 && unicode.IsDigit(ch)
+}
+
+func (t *Tokenizer) Text() string {
+	switch t.tok {
+	case LSH:
+		return "<<"
+	case RSH:
+		return ">>"
+	case ARR:
+		return "->"
+	case ROT:
+		return "@>"
+	}
+	return t.s.TokenText()
+}
+
+func (t *Tokenizer) FileName() string {
+	return t.fileName
+}
+
+func (t *Tokenizer) Line() int {
+	return t.line
+}
+
+func (t *Tokenizer) Col() int {
+	return t.col
+}
+
+func (t *Tokenizer) Expansion() string {
+	return ""
+}
+
+func (t *Tokenizer) SetPos(line int, file string) {
+	t.line = line
+	t.fileName = file
+}
+
+func (t *Tokenizer) Next() Token {
+	s := t.s
+	midLine := t.tok != 0 && t.tok != '\n'
+	for {
+		t.tok = Token(s.Scan())
+		if t.tok == '#' && t.hashComments && midLine {
+			// Skip the comment as text: it need not be made of tokens.
+			t.skipLine()
+			continue
+		}
+		if t.tok != scanner.Comment {
+			break
+		}
+		t.line += strings.Count(s.TokenText(), "\n")
+		// TODO: If we ever have //go: comments in assembly, will need to keep them here.
+		// For now, just discard all comments.
+	}
+	t.col = s.Position.Column
+	switch t.tok {
+	case '\n':
+		if t.hist != nil {
+			t.hist.line++
+		}
+		t.line++
+		t.col = 0 // The newline is on the previous line.
+	case '-':
+		if s.Peek() == '>' {
+			s.Next()
+			t.tok = ARR
+			return ARR
+		}
+	case '@':
+		if s.Peek() == '>' {
+			s.Next()
+			t.tok = ROT
+			return ROT
+		}
+	case '<':
+		if s.Peek() == '<' {
+			s.Next()
+			t.tok = LSH
+			return LSH
+		}
+	case '>':
+		if s.Peek() == '>' {
+			s.Next()
+			t.tok = RSH
+			return RSH
+		}
+	}
+	return t.tok
+}
+
+// skipLine discards the rest of the line, up to the newline, without scanning it.
+func (t *Tokenizer) skipLine() {
+	for t.s.Peek() != '\n' && t.s.Peek() != scanner.EOF {
+		t.s.Next()
+	}
+}
+
+// A Stack is a stack of TokenReaders. As the top TokenReader hits EOF,
+// it resumes reading the next one down.
+type Stack struct {
+	tr   []TokenReader
+	hist *lineHistory
+}
+
+// Push adds tr to the top of the input stack. (Popping happens automatically.)
+func (s *Stack) Push(tr TokenReader) {
+	s.tr = append(s.tr, tr)
+}
+
+func (s *Stack) Next() Token {
+	tok := s.tr[len(s.tr)-1].Next()
+	for tok == scanner.EOF && len(s.tr) > 1 {
+		// Pop the topmost item from the stack and resume with the next one down.
+		// TODO: close file descriptor.
+		s.hist.pop()
+		s.tr = s.tr[:len(s.tr)-1]
+		tok = s.Next()
+	}
+	return tok
+}
+
+func (s *Stack) Text() string {
+	return s.tr[len(s.tr)-1].Text()
+}
+
+func (s *Stack) FileName() string {
+	return s.tr[len(s.tr)-1].FileName()
+}
+
+func (s *Stack) Line() int {
+	return s.tr[len(s.tr)-1].Line()
+}
+
+func (s *Stack) Col() int {
+	return s.tr[len(s.tr)-1].Col()
+}
+
+func (s *Stack) Expansion() string {
+	return s.tr[len(s.tr)-1].Expansion()
+}
+
+// expansion returns the macro expansion producing the most recent token, or nil if there is none.
+func (s *Stack) expansion() *expansion {
+	if slice, ok := s.tr[len(s.tr)-1].(*Slice); ok {
+		return slice.exp
+	}
+	return nil
+}
+
+// hidden returns the macros that the most recent token must not invoke, because
+// it came from their expansion. As in cpp, this stops a macro from recurring.
+func (s *Stack) hidden() *expansion {
+	if slice, ok := s.tr[len(s.tr)-1].(*Slice); ok && slice.pos < len(slice.tokens) {
+		return slice.tokens[slice.pos].hide
+	}
+	return nil
+}
+
+func (s *Stack) SetPos(line int, file string) {
+	s.tr[len(s.tr)-1].SetPos(line, file)
+}
+
+// A Slice reads from a slice of LexTokens.
+type Slice struct {
+	tokens   []LexToken
+	fileName string
+	line     int
+	col      int
+	exp      *expansion // The macro expansion that produced the tokens, if any.
+	pos      int
+}
+
+// NewSlice returns a Slice reading the tokens, all of which are reported to be
+// at the given position.
+func NewSlice(fileName string, line, col int, tokens []LexToken) *Slice {
+	return &Slice{
+		tokens:   tokens,
+		fileName: fileName,
+		line:     line,
+		col:      col,
+		pos:      -1, // Next will advance to zero.
+	}
+}
+
+func (s *Slice) Next() Token {
+	s.pos++
+	if s.pos >= len(s.tokens) {
+		return scanner.EOF
+	}
+	return s.tokens[s.pos].Token
+}
+
+func (s *Slice) Text() string {
+	return s.tokens[s.pos].text
+}
+
+func (s *Slice) FileName() string {
+	return s.fileName
+}
+
+func (s *Slice) Line() int {
+	return s.line
+}
+
+func (s *Slice) Col() int {
+	return s.col
+}
+
+func (s *Slice) Expansion() string {
+	return s.exp.String()
+}
+
+func (s *Slice) SetPos(line int, file string) {
+	// Cannot happen because we only have slices of already-scanned
+	// text, but be prepared.
+	s.line = line
+	s.fileName = file
+}
+
+// Input is the main input: a stack of readers and some macro definitions.
+// It also handles #include processing (by pushing onto the input stack)
+// and parses and instantiates macro definitions.
+type Input struct {
+	Stack
+	includes        []string
+	beginningOfLine bool
+	ifdefStack      []ifdef
+	macros          map[string]*Macro
+	files           map[string]*includeFile // Included files, by cleaned path.
+	included        []string                // Names of the included files, in the order they were read.
+	diag            *Diagnostics
+	trace           *tracer
+	hashComments    bool // A line starting with # and no directive is a comment, as in the GNU dialect.
+	fs              FileSystem
+	goos, goarch    string // Replace _GOOS and _GOARCH in #include names.
+}
+
+// An includeFile holds the contents of an included file, read once and
+// tokenized again each time it is included.
+type includeFile struct {
+	data  []byte
+	guard string // Macro of the file's include guard, if it has one.
+	once  bool   // The file has #pragma once, so is included only once.
+}
+
+func NewInput(name string, diag *Diagnostics, hist *lineHistory, defines, includes []string) *Input {
+	return &Input{
+		Stack: Stack{hist: hist},
+		// include directories: look in source dir, then -I directories.
+		includes:        append([]string{filepath.Dir(name)}, includes...),
+		beginningOfLine: true,
+		macros:          predefine(diag, defines),
+		files:           make(map[string]*includeFile),
+		included:        []string{},
+		diag:            diag,
+		fs:              osFS{},
+	}
+}
+
+// predefine installs the macros set by the -D flag on the command line.
+func predefine(diag *Diagnostics, defines []string) map[string]*Macro {
+	macros := make(map[string]*Macro)
+	for _, name := range defines {
+		value := "1"
+		i := strings.IndexRune(name, '=')
+		if i > 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		tokens := tokenize(name)
+		if len(tokens) != 1 || tokens[0].Token != scanner.Ident {
+			diag.Report(Diagnostic{
+				File:     "command line",
+				Severity: Error,
+				Msg:      fmt.Sprintf("-D: invalid macro name %q", name),
+			})
+			continue
+		}
+		tokens, ok := scanTokens(value)
+		if !ok {
+			diag.Report(Diagnostic{
+				File:     "command line",
+				Severity: Error,
+				Msg:      fmt.Sprintf("-D: invalid value %q for macro %s", value, name),
+			})
+			continue
+		}
+		macros[name] = &Macro{
+			name:   name,
+			args:   nil,
+			tokens: tokens,
+			file:   "command line",
+		}
+	}
+	return macros
+}
+
+// Error reports an error at the current input position and abandons the assembly:
+// the input cannot be resynchronized after a preprocessing error.
+func (in *Input) Error(args ...interface{}) {
+	in.errorAt(in.FileName(), in.Line(), in.Col(), args...)
+}
+
+// errorAt is like Error but reports the error at the given position. A zero column means the whole line.
+func (in *Input) errorAt(file string, line, col int, args ...interface{}) {
+	in.diag.Report(Diagnostic{
+		File:     file,
+		Line:     line,
+		Col:      col,
+		Severity: Error,
+		Msg:      strings.TrimSuffix(fmt.Sprintln(args...), "\n"),
+	})
+	panic(bailout{})
+}
+
+// scanError returns the handler for errors found by the scanner of t, such as
+// an unterminated string. The scanner recovers from them, so they do not stop
+// the assembly unless there are too many.
+func (in *Input) scanError(t *Tokenizer) func(*scanner.Scanner, string) {
+	return func(s *scanner.Scanner, msg string) {
+		pos := s.Position
+		if !pos.IsValid() {
+			pos = s.Pos()
+		}
+		if in.diag.Report(Diagnostic{File: t.FileName(), Line: t.Line(), Col: pos.Column, Severity: Error, Msg: msg}) {
+			panic(bailout{})
+		}
+	}
+}
+
+// expect is like Error but adds "got XXX" where XXX is a quoted representation of the most recent token.
+func (in *Input) expectText(args ...interface{}) {
+	in.Error(append(args, "; got", strconv.Quote(in.Text()))...)
+}
+
+// An ifdef holds the state of a conditional: #if, #ifdef or #ifndef, through to #endif.
+type ifdef struct {
+	outer   bool // The text around the conditional is being included.
+	taken   bool // A branch has been included, so any later #elif or #else is skipped.
+	on      bool // The current branch is being included.
+	sawElse bool
+}
+
+// including reports whether the input is enabled by an ifdef, or is at the top level.
+func (in *Input) including() bool {
+	return len(in.ifdefStack) == 0 || in.ifdefStack[len(in.ifdefStack)-1].on
+}
+
+func (in *Input) expectNewline(directive string) {
+	tok := in.Stack.Next()
+	if tok != '\n' {
+		in.expectText("expected newline after", directive)
+	}
+}
+
+func (in *Input) Next() Token {
+	for {
+		tok := in.Stack.Next()
+		switch tok {
+		case '#':
+			if !in.beginningOfLine {
+				in.Error("'#' must be first item on line")
+			}
+			in.beginningOfLine = in.hash()
+		case scanner.Ident:
+			// Is it a macro name? Macros are not expanded in text that is being skipped.
+			name := in.Stack.Text()
+			macro := in.macros[name]
+			if macro != nil && in.including() && !in.Stack.hidden().contains(name) {
+				in.invokeMacro(macro)
+				continue
+			}
+			in.beginningOfLine = false
+			if in.including() {
+				return tok
+			}
+		case scanner.EOF:
+			if len(in.ifdefStack) > 0 {
+				in.ifdefStack = nil
+				in.Error("unterminated #if")
+			}
+			return tok
+		default:
+			in.beginningOfLine = tok == '\n'
+			if in.including() {
+				return tok
+			}
+		}
+	}
+}
+
+// hash processes a # preprocessor directive. It returns true iff it completes.
+func (in *Input) hash() bool {
+	// We have a #, it must be followed by a known word (define, include, etc.).
+	tok := in.Stack.Next()
+	if in.hashComments && (tok != scanner.Ident || !hashDirectives[in.Text()]) {
+		// A comment, or a line marker such as # 12 "x.c" from a C preprocessor.
+		// The rest of a comment is text, such as "don't", so skip it unscanned if possible.
+		if t, ok := in.tr[len(in.tr)-1].(*Tokenizer); ok && tok != '\n' && tok != scanner.EOF {
+			t.skipLine()
+			tok = in.Stack.Next()
+		}
+		for tok != '\n' && tok != scanner.EOF {
+			tok = in.Stack.Next()
+		}
+		return true
+	}
+	if tok != scanner.Ident {
+		in.expectText("expected identifier after '#'")
+	}
+	if !in.including() {
+		// Can only start including again if we are at #elif, #else or #endif.
+		// A conditional inside skipped text must still be matched to its #endif.
+		// We let #line through because it might affect errors.
+		// The rest of any other directive is not parsed: it may hold # or ## from a #define.
+		switch in.Text() {
+		case "if", "ifdef", "ifndef":
+			in.pushIfdef(false)
+			in.skipDirective()
+			return true
+		case "elif", "else", "endif", "line":
+			// Press on.
+		default:
+			in.skipDirective()
+			return true
+		}
+	}
+	switch in.Text() {
+	case "define":
+		in.define()
+	case "elif":
+		return in.elif()
+	case "else":
+		in.else_()
+	case "endif":
+		in.endif()
+	case "if":
+		in.pushIfdef(in.ifCondition("#if"))
+	case "ifdef":
+		in.ifdef(true)
+	case "ifndef":
+		in.ifdef(false)
+	case "include":
+		in.include()
+	case "line":
+		in.line()
+	case "pragma":
+		in.pragma()
+	case "undef":
+		in.undef()
+	default:
+		in.Error("unexpected identifier after '#':", in.Text())
+	}
+	return true
+}
+
+// skipDirective discards the rest of a directive in skipped text, including
+// lines joined to it by backslash-newline.
+func (in *Input) skipDirective() {
+	for tok := in.Stack.Next(); tok != '\n' && tok != scanner.EOF; tok = in.Stack.Next() {
+		if tok == '\\' {
+			in.Stack.Next()
+		}
+	}
+}
+
+// hashDirectives are the words that may follow #.
+var hashDirectives = map[string]bool{
+	"define":  true,
+	"elif":    true,
+	"else":    true,
+	"endif":   true,
+	"if":      true,
+	"ifdef":   true,
+	"ifndef":  true,
+	"include": true,
+	"line":    true,
+	"pragma":  true,
+	"undef":   true,
+}
+
+// macroName returns the name for the macro being referenced.
+func (in *Input) macroName() string {
+	// We use the Stacks' input method; no macro processing at this stage.
+	tok := in.Stack.Next()
+	if tok != scanner.Ident {
+		in.expectText("expected identifier after # directive")
+	}
+	// Name is alphanumeric by definition.
+	return in.Text()
+}
+
+// #define processing.
+func (in *Input) define() {
+	file, line := in.FileName(), in.Line()
+	name := in.macroName()
+	args, variadic, tokens := in.macroDefinition(name)
+	macro := &Macro{
+		name:     name,
+		args:     args,
+		variadic: variadic,
+		tokens:   tokens,
+		file:     file,
+		line:     line,
+	}
+	in.checkMacroBody(macro)
+	in.defineMacro(macro)
+	in.trace.printf(TraceLex, file, line, "#define %s", name)
+}
+
+// defineMacro stores the macro definition in the Input.
+func (in *Input) defineMacro(macro *Macro) {
+	if in.macros[macro.name] != nil {
+		in.Error("redefinition of macro:", macro.name)
+	}
+	in.macros[macro.name] = macro
+}
+
+// macroDefinition returns the list of formals, whether the macro is variadic, and the tokens
+// of the definition. The argument list is nil for no parens on the definition; otherwise a list
+// of formal argument names. The formals of a variadic macro end with __VA_ARGS__, which stands
+// for the "..." in the definition. The definition may be empty, as in an include guard.
+func (in *Input) macroDefinition(name string) ([]string, bool, []LexToken) {
+	tok := in.Stack.Next()
+	var args []string
+	variadic := false
+	if tok == '(' {
+		// Macro has arguments. Scan list of formals.
+		args = []string{}
+		acceptArg := true
+	Loop:
+		for {
+			tok = in.Stack.Next()
+			switch tok {
+			case ')':
+				if acceptArg && len(args) > 0 {
+					in.Error("bad syntax in definition for macro:", name)
+				}
+				tok = in.Stack.Next() // First token of macro definition.
+				break Loop
+			case ',':
+				if acceptArg || variadic {
+					in.Error("bad syntax in definition for macro:", name)
+				}
+				acceptArg = true
+			case '.':
+				// The ... of a variadic macro, which must be the last formal.
+				if !acceptArg || in.Stack.Next() != '.' || in.Stack.Next() != '.' {
+					in.Error("bad syntax in definition for macro:", name)
+				}
+				args = append(args, "__VA_ARGS__")
+				variadic = true
+				acceptArg = false
+			case scanner.Ident:
+				if !acceptArg || variadic {
+					in.Error("bad syntax in definition for macro:", name)
+				}
+				arg := in.Stack.Text()
+				if i := lookup(args, arg); i >= 0 {
+					in.Error("duplicate argument", arg, "in definition for macro:", name)
+				}
+				if arg == "__VA_ARGS__" {
+					in.Error("__VA_ARGS__ used as argument name in definition for macro:", name)
+				}
+				args = append(args, arg)
+				acceptArg = false
+			default:
+				in.Error("bad definition for macro:", name)
+			}
+		}
+	}
+	var tokens []LexToken
+	// Scan to newline. Backslashes escape newlines.
+	for tok != '\n' {
+		if tok == scanner.EOF {
+			break
+		}
+		if tok == '\\' {
+			tok = in.Stack.Next()
+			if tok != '\n' && tok != '\\' {
+				in.Error(`can only escape \ or \n in definition for macro:`, name)
+			}
+			if tok == '\n' { // backslash-newline is discarded
+				tok = in.Stack.Next()
+				continue
+			}
+		}
+		tokens = append(tokens, LexToken{Token: Token(tok), text: in.Text()})
+		tok = in.Stack.Next()
+	}
+	return args, variadic, tokens
+}
+
+// checkMacroBody verifies the uses of #, ## and __VA_ARGS__ in a macro definition.
+// In a macro with arguments, # must precede the name of an argument, which it turns
+// into a string. ## pastes together the tokens on either side, so cannot be first or last.
+// The definition has been read by now, so errors are reported at the line of the #define.
+func (in *Input) checkMacroBody(macro *Macro) {
+	name, args, tokens := macro.name, macro.args, macro.tokens
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.Token == '#' && i+1 < len(tokens) && tokens[i+1].Token == '#':
+			if i == 0 || i+2 == len(tokens) {
+				in.errorAt(macro.file, macro.line, 0, "'##' cannot appear at either end of definition for macro:", name)
+			}
+			i++
+		case tok.Token == '#' && args != nil:
+			if i+1 == len(tokens) || tokens[i+1].Token != scanner.Ident || lookup(args, tokens[i+1].text) < 0 {
+				in.errorAt(macro.file, macro.line, 0, "'#' is not followed by an argument in definition for macro:", name)
+			}
+		case tok.Token == scanner.Ident && tok.text == "__VA_ARGS__" && lookup(args, tok.text) < 0:
+			in.errorAt(macro.file, macro.line, 0, "__VA_ARGS__ used in definition of non-variadic macro:", name)
+		}
+	}
+}
+
+func lookup(args []string, arg string) int {
+	for i, a := range args {
+		if a == arg {
+			return i
+		}
+	}
+	return -1
+}
+
+// macroError is like Error but also says where the macro being expanded was defined.
+func (in *Input) macroError(macro *Macro, args ...interface{}) {
+	in.Error(append(args, "("+macro.site()+")")...)
+}
+
+// invokeMacro pushes onto the input Stack a Slice that holds the macro definition with the actual
+// parameters substituted for the formals, stringified by # and pasted together by ##.
+// The expanded tokens have the position of the invocation.
+func (in *Input) invokeMacro(macro *Macro) {
+	file, line, col := in.FileName(), in.Line(), in.Col()
+	exp := &expansion{macro: macro, outer: in.Stack.expansion()}
+	hide := &expansion{macro: macro, outer: in.Stack.hidden()}
+	actuals := in.argsFor(macro)
+	var tokens []LexToken
+	body := macro.tokens
+	for i := 0; i < len(body); i++ {
+		tok := body[i]
+		tok.hide = hide
+		switch {
+		case tok.Token == '#' && i+1 < len(body) && body[i+1].Token == '#':
+			// Token pasting: paste the last token so far to the first of the next operand.
+			// The definition has been checked, so there is a next operand.
+			i += 2
+			right := in.substitute(body[i], actuals)
+			if len(right) == 0 {
+				break
+			}
+			if len(tokens) == 0 {
+				tokens = right
+				break
+			}
+			left := tokens[len(tokens)-1]
+			pasted, ok := scanTokens(left.text + right[0].text)
+			if len(pasted) != 1 || !ok {
+				in.macroError(macro, "pasting", left.text, "and", right[0].text, "does not give a valid token")
+			}
+			pasted[0].hide = hide
+			tokens = append(tokens[:len(tokens)-1], pasted...)
+			tokens = append(tokens, right[1:]...)
+		case tok.Token == '#' && macro.args != nil:
+			// Stringification: the definition has been checked, so an argument name follows.
+			i++
+			tokens = append(tokens, stringify(actuals[body[i].text]))
+		default:
+			tokens = append(tokens, in.substitute(tok, actuals)...)
+		}
+	}
+	slice := NewSlice(file, line, col, tokens)
+	slice.exp = exp
+	in.Push(slice)
+}
+
+// substitute returns the actual argument if tok is the name of a formal, or else tok itself.
+func (in *Input) substitute(tok LexToken, actuals map[string][]LexToken) []LexToken {
+	if tok.Token == scanner.Ident {
+		if actual, ok := actuals[tok.text]; ok {
+			return actual
+		}
+	}
+	return []LexToken{tok}
+}
+
+// stringify returns a string token holding the text of the tokens, as for #arg.
+// The original spacing is lost, so a space is put only between words, as in "MOVQ AX".
+func stringify(tokens []LexToken) LexToken {
+	var buf bytes.Buffer
+	for i, tok := range tokens {
+		if i > 0 && isWord(tokens[i-1].Token) && isWord(tok.Token) {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(tok.text)
+	}
+	return LexToken{Token: scanner.String, text: strconv.Quote(buf.String())}
+}
+
+// isWord reports whether the token is an identifier or literal, which must be separated by space.
+func isWord(tok Token) bool {
+	switch tok {
+	case scanner.Ident, scanner.Int, scanner.Float, scanner.Char, scanner.String, scanner.RawString:
+		return true
+	}
+	return false
+}
+
+// argsFor returns a map from formal name to actual value for this macro invocation.
+// Commas within parentheses, as in 8(SP), do not separate arguments. The last argument
+// of a variadic macro takes all the remaining ones, including their commas.
+func (in *Input) argsFor(macro *Macro) map[string][]LexToken {
+	if macro.args == nil {
+		return nil
+	}
+	tok := in.Stack.Next()
+	if tok != '(' {
+		in.macroError(macro, "missing arguments for invocation of macro:", macro.name)
+	}
+	line := in.Line()
+	var tokens []LexToken
+	args := make(map[string][]LexToken)
+	argNum := 0
+	nesting := 0
+	for {
+		tok = in.Stack.Next()
+		switch {
+		case tok == scanner.EOF || tok == '\n':
+			in.errorAt(in.FileName(), line, 0, "unterminated arg list invoking macro:", macro.name, "("+macro.site()+")")
+		case tok == '(':
+			nesting++
+			tokens = append(tokens, LexToken{Token: tok, text: in.Stack.Text(), hide: in.Stack.hidden()})
+		case tok == ')' && nesting > 0:
+			nesting--
+			tokens = append(tokens, LexToken{Token: tok, text: in.Stack.Text(), hide: in.Stack.hidden()})
+		case tok == ',' && nesting == 0 && !(macro.variadic && argNum == len(macro.args)-1), tok == ')':
+			if argNum >= len(macro.args) {
+				if len(macro.args) > 0 || tokens != nil {
+					in.macroError(macro, "too many arguments for macro:", macro.name)
+				}
+			} else {
+				args[macro.args[argNum]] = tokens
+			}
+			tokens = nil
+			argNum++
+			if tok == ')' {
+				if macro.variadic && argNum == len(macro.args)-1 {
+					// No variable arguments.
+					args["__VA_ARGS__"] = nil
+					argNum++
+				}
+				if argNum < len(macro.args) {
+					in.macroError(macro, "too few arguments for macro:", macro.name)
+				}
+				return args
+			}
+		default:
+			tokens = append(tokens, LexToken{Token: tok, text: in.Stack.Text(), hide: in.Stack.hidden()})
+		}
+	}
+}
+
+// #ifdef and #ifndef processing.
+func (in *Input) ifdef(truth bool) {
+	name := in.macroName()
+	in.expectNewline("#if[n]def")
+	if _, defined := in.macros[name]; !defined {
+		truth = !truth
+	}
+	in.pushIfdef(truth)
+}
+
+// pushIfdef starts a conditional whose first branch is included if truth holds
+// and the surrounding text is being included.
+func (in *Input) pushIfdef(truth bool) {
+	outer := in.including()
+	in.ifdefStack = append(in.ifdefStack, ifdef{
+		outer: outer,
+		taken: outer && truth,
+		on:    outer && truth,
+	})
+}
+
+// #elif processing. The condition is evaluated only if no earlier branch was taken;
+// otherwise elif reports false so the rest of the line is skipped.
+func (in *Input) elif() bool {
+	if len(in.ifdefStack) == 0 {
+		in.Error("unmatched #elif")
+	}
+	cond := &in.ifdefStack[len(in.ifdefStack)-1]
+	if cond.sawElse {
+		in.Error("#elif after #else")
+	}
+	if !cond.outer || cond.taken {
+		cond.on = false
+		return false
+	}
+	cond.on = in.ifCondition("#elif")
+	cond.taken = cond.on
+	return true
+}
+
+// #else processing
+func (in *Input) else_() {
+	in.expectNewline("#else")
+	if len(in.ifdefStack) == 0 {
+		in.Error("unmatched #else")
+	}
+	cond := &in.ifdefStack[len(in.ifdefStack)-1]
+	if cond.sawElse {
+		in.Error("#else after #else")
+	}
+	cond.sawElse = true
+	cond.on = cond.outer && !cond.taken
+	cond.taken = true
+}
+
+// #endif processing.
+func (in *Input) endif() {
+	in.expectNewline("#endif")
+	if len(in.ifdefStack) == 0 {
+		in.Error("unmatched #endif")
+	}
+	in.ifdefStack = in.ifdefStack[:len(in.ifdefStack)-1]
+}
+
+// ifCondition reads the rest of the line after #if or #elif and reports whether
+// the constant expression there is non-zero. As in C, defined(NAME) or defined NAME
+// is 1 if NAME is a macro, other macros are expanded, and any identifiers that remain
+// have value 0.
+func (in *Input) ifCondition(directive string) bool {
+	file, line := in.FileName(), in.Line()
+	var tokens []LexToken
+	for {
+		tok := in.Stack.Next()
+		if tok == '\n' || tok == scanner.EOF {
+			break
+		}
+		if tok == scanner.Ident {
+			name := in.Stack.Text()
+			if name == "defined" {
+				tokens = append(tokens, in.definedOperator(directive))
+				continue
+			}
+			if macro := in.macros[name]; macro != nil && !in.Stack.hidden().contains(name) {
+				in.invokeMacro(macro)
+				continue
+			}
+		}
+		tokens = append(tokens, LexToken{Token: tok, text: in.Stack.Text()})
+	}
+	if len(tokens) == 0 {
+		in.errorAt(file, line, 0, "missing expression after", directive)
+	}
+	e := &ifExpr{in: in, directive: directive, file: file, line: line, tokens: tokens, eval: true}
+	v := e.conditional()
+	if e.pos < len(tokens) {
+		e.error("unexpected", strconv.Quote(tokens[e.pos].text))
+	}
+	return v != 0
+}
+
+// definedOperator parses the operand of defined, which has just been read,
+// and returns the integer token for its value.
+func (in *Input) definedOperator(directive string) LexToken {
+	tok := in.Stack.Next()
+	paren := tok == '('
+	if paren {
+		tok = in.Stack.Next()
+	}
+	if tok != scanner.Ident {
+		in.expectText("expected identifier after defined in", directive)
+	}
+	value := "0"
+	if in.macros[in.Stack.Text()] != nil {
+		value = "1"
+	}
+	if paren && in.Stack.Next() != ')' {
+		in.expectText("expected ')' after defined in", directive)
+	}
+	return LexToken{Token: scanner.Int, text: value}
+}
+
+// An ifExpr evaluates the expression of an #if or #elif. The grammar and precedence
+// are those of C. Operands are int64s; eval is false in an operand that is not
+// evaluated, such as the right of 0 && x, so a division by zero there is harmless.
+type ifExpr struct {
+	in        *Input
+	directive string
+	file      string // Position of the directive, for errors.
+	line      int
+	tokens    []LexToken
+	pos       int
+	eval      bool
+}
+
+// ifPrecedence holds the precedence of the binary operators, with || the loosest.
+var ifPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+// peek returns the operator or punctuation at the current position, joining the
+// two-character operators, which the tokenizer returns as separate runes.
+// It also returns the number of tokens the operator occupies.
+func (e *ifExpr) peek() (string, int) {
+	if e.pos >= len(e.tokens) {
+		return "", 0
+	}
+	tok := e.tokens[e.pos]
+	switch tok.Token {
+	case LSH:
+		return "<<", 1
+	case RSH:
+		return ">>", 1
+	case scanner.Ident, scanner.Int, scanner.Float, scanner.Char, scanner.String, scanner.RawString:
+		return "", 0
+	}
+	if e.pos+1 < len(e.tokens) {
+		switch pair := tok.text + e.tokens[e.pos+1].text; pair {
+		case "||", "&&", "==", "!=", "<=", ">=":
+			return pair, 2
+		}
+	}
+	return tok.text, 1
+}
+
+// accept consumes the operator op if it is next, and reports whether it was.
+func (e *ifExpr) accept(op string) bool {
+	if next, n := e.peek(); next == op {
+		e.pos += n
+		return true
+	}
+	return false
+}
+
+func (e *ifExpr) error(args ...interface{}) {
+	e.in.errorAt(e.file, e.line, 0, append(args, "in", e.directive, "expression")...)
+}
+
+// conditional parses cond ? x : y, or a binary expression.
+func (e *ifExpr) conditional() int64 {
+	c := e.binary(1)
+	if !e.accept("?") {
+		return c
+	}
+	eval := e.eval
+	e.eval = eval && c != 0
+	x := e.conditional()
+	if !e.accept(":") {
+		e.error("missing ':'")
+	}
+	e.eval = eval && c == 0
+	y := e.conditional()
+	e.eval = eval
+	if c != 0 {
+		return x
+	}
+	return y
+}
+
+// binary parses a sequence of operands joined by operators of at least precedence prec.
+func (e *ifExpr) binary(prec int) int64 {
+	x := e.unary()
+	for {
+		op, n := e.peek()
+		p, ok := ifPrecedence[op]
+		if !ok || p < prec {
+			return x
+		}
+		e.pos += n
+		eval := e.eval
+		switch op {
+		case "&&":
+			e.eval = eval && x != 0
+		case "||":
+			e.eval = eval && x == 0
+		}
+		y := e.binary(p + 1)
+		e.eval = eval
+		x = e.apply(op, x, y)
+	}
+}
+
+func (e *ifExpr) apply(op string, x, y int64) int64 {
+	switch op {
+	case "||":
+		return truth(x != 0 || y != 0)
+	case "&&":
+		return truth(x != 0 && y != 0)
+	case "|":
+		return x | y
+	case "^":
+		return x ^ y
+	case "&":
+		return x & y
+	case "==":
+		return truth(x == y)
+	case "!=":
+		return truth(x != y)
+	case "<":
+		return truth(x < y)
+	case "<=":
+		return truth(x <= y)
+	case ">":
+		return truth(x > y)
+	case ">=":
+		return truth(x >= y)
+	case "<<", ">>":
+		if y < 0 || y > 63 {
+			if e.eval {
+				e.error("invalid shift count", y)
+			}
+			return 0
+		}
+		if op == "<<" {
+			return x << uint(y)
+		}
+		return x >> uint(y)
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	}
+	// Division and remainder.
+	if y == 0 {
+		if e.eval {
+			e.error("division by zero")
+		}
+		return 0
+	}
+	if op == "/" {
+		return x / y
+	}
+	return x % y
+}
+
+// unary parses a unary operator, a parenthesized expression, or an operand.
+func (e *ifExpr) unary() int64 {
+	op, n := e.peek()
+	switch op {
+	case "!":
+		e.pos += n
+		return truth(e.unary() == 0)
+	case "~":
+		e.pos += n
+		return ^e.unary()
+	case "-":
+		e.pos += n
+		return -e.unary()
+	case "+":
+		e.pos += n
+		return e.unary()
+	case "(":
+		e.pos += n
+		x := e.conditional()
+		if !e.accept(")") {
+			e.error("missing ')'")
+		}
+		return x
+	}
+	if e.pos >= len(e.tokens) {
+		e.error("missing operand")
+	}
+	tok := e.tokens[e.pos]
+	e.pos++
+	switch tok.Token {
+	case scanner.Ident:
+		// An identifier that is not a macro.
+		return 0
+	case scanner.Int:
+		v, err := strconv.ParseInt(tok.text, 0, 64)
+		if err != nil {
+			e.error("bad integer", tok.text)
+		}
+		return v
+	case scanner.Char:
+		// An unterminated literal, which the scanner has reported, may be just the quote.
+		if len(tok.text) < 2 {
+			e.error("bad character constant", tok.text)
+		}
+		r, _, _, err := strconv.UnquoteChar(tok.text[1:len(tok.text)-1], '\'')
+		if err != nil {
+			e.error("bad character constant", tok.text)
+		}
+		return int64(r)
+	}
+	e.error("unexpected", strconv.Quote(tok.text))
+	return 0
+}
+
+func truth(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// #include processing.
+func (in *Input) include() {
+	line := in.Line()
+	// Find and parse string.
+	tok := in.Stack.Next()
+	if tok != scanner.String {
+		in.expectText("expected string after #include")
+	}
+	name, err := strconv.Unquote(in.Text())
+	if err != nil {
+		in.Error("unquoting include file name: ", err)
+	}
+	in.expectNewline("#include")
+	// Replace GOOS and GOARCH as required.
+	name = strings.Replace(name, "_GOOS", "_"+in.goos, -1)
+	name = strings.Replace(name, "_GOARCH", "_"+in.goarch, -1)
+	file, path, err := in.findInclude(name)
+	if err != nil {
+		in.errorAt(in.FileName(), line, 0, "#include:", err)
+	}
+	// A file with #pragma once, or whose include guard is defined, would contribute nothing.
+	if file.once || file.guard != "" && in.macros[file.guard] != nil {
+		return
+	}
+	// Detect cycles now; otherwise they are caught only by the recursion limit in Push.
+	var chain []string
+	cycle := false
+	for _, tr := range in.tr {
+		if t, ok := tr.(*Tokenizer); ok {
+			chain = append(chain, t.FileName())
+			cycle = cycle || t.path == path
+		}
+	}
+	if cycle {
+		in.errorAt(in.FileName(), line, 0, "#include cycle:", strings.Join(append(chain, name), " includes "))
+	}
+	in.trace.printf(TraceLex, in.FileName(), line, "#include %q (%s)", name, path)
+	t := NewTokenizer(name, bytes.NewReader(file.data), in.hist)
+	t.path = path
+	t.hashComments = in.hashComments
+	t.s.Error = in.scanError(t)
+	in.Push(t)
+}
+
+// findInclude returns the named include file and its path. The name is tried as
+// given and then in each include directory. The path is only joined and cleaned,
+// never made absolute, so the file system alone decides what it refers to.
+// A file is read only the first time it is included.
+func (in *Input) findInclude(name string) (*includeFile, string, error) {
+	var err error
+	for _, dir := range append([]string{""}, in.includes...) {
+		path := filepath.Join(dir, name)
+		if file := in.files[path]; file != nil {
+			return file, path, nil
+		}
+		var data []byte
+		data, err = in.readFile(path)
+		if err != nil {
+			continue
+		}
+		file := &includeFile{
+			data:  data,
+			guard: includeGuard(data),
+		}
+		in.files[path] = file
+		in.included = append(in.included, path)
+		return file, path, nil
+	}
+	return nil, "", err
+}
+
+// readFile returns the contents of the file at path, read from the file system.
+func (in *Input) readFile(path string) ([]byte, error) {
+	f, err := in.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// includeGuard returns the macro that guards the file, or "" if there is none. A file is guarded
+// if, apart from comments and blank lines, it is a single #ifndef X, #define X, ..., #endif.
+func includeGuard(data []byte) string {
+	t := NewTokenizer("", bytes.NewReader(data), nil)
+	t.s.Error = func(*scanner.Scanner, string) {} // Errors are reported when the file is included.
+	next := func() Token {
+		tok := t.Next()
+		for tok == '\n' {
+			tok = t.Next()
+		}
+		return tok
+	}
+	directive := func(name string) bool {
+		return next() == '#' && t.Next() == scanner.Ident && t.Text() == name
+	}
+	if !directive("ifndef") || t.Next() != scanner.Ident {
+		return ""
+	}
+	guard := t.Text()
+	if t.Next() != '\n' || !directive("define") || t.Next() != scanner.Ident || t.Text() != guard {
+		return ""
+	}
+	// Find the #endif that matches the #ifndef; nothing but blank lines may follow it.
+	depth := 1
+	beginningOfLine := false
+	for tok := t.Next(); tok != scanner.EOF; tok = t.Next() {
+		if tok == '#' && beginningOfLine {
+			if t.Next() != scanner.Ident {
+				return ""
+			}
+			switch t.Text() {
+			case "if", "ifdef", "ifndef":
+				depth++
+			case "elif", "else":
+				if depth == 1 {
+					return ""
+				}
+			case "endif":
+				depth--
+				if depth == 0 {
+					if next() != scanner.EOF {
+						return ""
+					}
+					return guard
+				}
+			}
+		}
+		beginningOfLine = tok == '\n'
+	}
+	return ""
+}
+
+// Included returns the names of the files read by #include so far, each once, in the
+// order they were first read. A file found in an include directory is named by its
+// path there, so the names suit a make-style list of dependencies.
+func (in *Input) Included() []string {
+	return in.included
+}
+
+// #pragma processing. Only #pragma once is supported.
+func (in *Input) pragma() {
+	tok := in.Stack.Next()
+	if tok != scanner.Ident || in.Text() != "once" {
+		in.expectText("expected once after #pragma")
+	}
+	in.expectNewline("#pragma once")
+	// Mark the file being read, which is the topmost Tokenizer.
+	for i := len(in.tr) - 1; i >= 0; i-- {
+		if t, ok := in.tr[i].(*Tokenizer); ok {
+			file := in.files[t.path]
+			if file == nil {
+				// The file being assembled.
+				file = &includeFile{}
+				in.files[t.path] = file
+			}
+			file.once = true
+			return
+		}
+	}
+}
+
+// #line processing.
+func (in *Input) line() {
+	// Only need to handle Plan 9 format: #line 337 "filename"
+	tok := in.Stack.Next()
+	if tok != scanner.Int {
+		in.expectText("expected line number after #line")
+	}
+	line, err := strconv.Atoi(in.Stack.Text())
+	if err != nil {
+		in.Error("error parsing #line (cannot happen):", err)
+	}
+	tok = in.Stack.Next()
+	if tok != scanner.String {
+		in.expectText("expected file name in #line")
+	}
+	file, err := strconv.Unquote(in.Stack.Text())
+	if err != nil {
+		in.Error("unquoting #line file name: ", err)
+	}
+	in.trace.printf(TraceLex, in.FileName(), in.Line(), "#line %d %q", line, file)
+	in.hist.record(file, line)
+	in.Stack.SetPos(line, file)
+}
+
+// #undef processing
+func (in *Input) undef() {
+	file, line := in.FileName(), in.Line()
+	name := in.macroName()
+	if in.macros[name] == nil {
+		in.Error("#undef for undefined macro:", name)
+	}
+	// Newline must be next.
+	tok := in.Stack.Next()
+	if tok != '\n' {
+		in.Error("syntax error in #undef for macro:", name)
+	}
+	delete(in.macros, name)
+	in.trace.printf(TraceLex, file, line, "#undef %s", name)
+}
+
+func (in *Input) Push(r TokenReader) {
+	if len(in.tr) > 100 {
+		in.Error("input recursion")
+	}
+	in.Stack.Push(r)
+}
@@ -0,0 +1,453 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+func TestTrimmedPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := string(filepath.Separator)
+	root := filepath.Join(sep, "home", "gopher")
+	tests := []struct {
+		name, prefix, result string
+	}{
+		{filepath.Join(root, "src", "a.s"), "", filepath.Join(root, "src", "a.s")},
+		{filepath.Join(root, "src", "a.s"), root, filepath.Join("src", "a.s")},
+		{filepath.Join(root, "src", "a.s"), root + sep, filepath.Join("src", "a.s")},
+		{filepath.Join(root, "src", "a.s"), filepath.Join(sep, "home", "go"), filepath.Join(root, "src", "a.s")},
+		{filepath.Join(sep, "tmp", "a.s"), root, filepath.Join(sep, "tmp", "a.s")},
+		{filepath.Join("testdata", "arm.s"), wd, filepath.Join("testdata", "arm.s")},
+		{filepath.Join("testdata", "arm.s"), filepath.Dir(wd), filepath.Join(filepath.Base(wd), "testdata", "arm.s")},
+	}
+	for _, test := range tests {
+		if got := trimmedPath(test.name, test.prefix); got != test.result {
+			t.Errorf("trimmedPath(%q, %q) = %q; want %q", test.name, test.prefix, got, test.result)
+		}
+	}
+}
+
+var macroTests = []struct {
+	name   string
+	input  string
+	output string // Tokens separated by '.', or the error message.
+}{
+	{
+		"empty",
+		"#define A\nA B\n",
+		"B.\n",
+	},
+	{
+		"simple",
+		"#define A 1\nA\n",
+		"1.\n",
+	},
+	{
+		"args",
+		"#define A(x, y) x+y\nA(1, 2)\n",
+		"1.+.2.\n",
+	},
+	{
+		"parenthesized argument",
+		"#define LOAD(a, r) MOVQ a, r\nLOAD(8(SP), AX)\n",
+		"MOVQ.8.(.SP.).,.AX.\n",
+	},
+	{
+		"empty argument",
+		"#define A(x, y) x y\nA(, 2)\n",
+		"2.\n",
+	},
+	{
+		"no arguments",
+		"#define A() 1\nA()\n",
+		"1.\n",
+	},
+	{
+		"multi-line",
+		"#define A(x) \\\n\tMOVQ x, AX; \\\n\tRET\nA(BX)\n",
+		"MOVQ.BX.,.AX.;.RET.\n",
+	},
+	{
+		"variadic",
+		"#define A(op, ...) op __VA_ARGS__\nA(MOVQ, $1, (AX)(BX*8))\n",
+		"MOVQ.$.1.,.(.AX.).(.BX.*.8.).\n",
+	},
+	{
+		"variadic with no arguments",
+		"#define A(op, ...) op __VA_ARGS__\nA(RET)\n",
+		"RET.\n",
+	},
+	{
+		"stringify",
+		"#define S(x) #x\nS(MOVQ 8(SP))\n",
+		`"MOVQ 8(SP)".` + "\n",
+	},
+	{
+		"stringify quotes",
+		"#define S(x) #x\nS(\"a\\n\")\n",
+		`"\"a\\n\"".` + "\n",
+	},
+	{
+		"paste",
+		"#define R(n) R ## n\nR(12)\n",
+		"R12.\n",
+	},
+	{
+		"paste formals",
+		"#define J(a, b) a##b\nJ(MOV, Q) AX, BX\n",
+		"MOVQ.AX.,.BX.\n",
+	},
+	{
+		"paste empty",
+		"#define J(a, b) a##b\nJ(, X0)\n",
+		"X0.\n",
+	},
+	{
+		"self reference",
+		"#define X X+1\nX\n",
+		"X.+.1.\n",
+	},
+	{
+		"recursion",
+		"#define F(x) F(x x) x\nF(1)\n",
+		"F.(.1.1.).1.\n",
+	},
+	{
+		"indirect recursion",
+		"#define F G\n#define G F\nF G\n",
+		"F.G.\n",
+	},
+	{
+		"nested invocation",
+		"#define A(x) (x)\nA(A(1))\n",
+		"(.(.1.).).\n",
+	},
+	{
+		"bad paste",
+		"#define J(a, b) a##b\nJ(+, -)\n",
+		"test:2:7: pasting + and - does not give a valid token (macro J defined at test:1)",
+	},
+	{
+		"paste at start",
+		"#define J(a) ## a\n",
+		"test:1: '##' cannot appear at either end of definition for macro: J",
+	},
+	{
+		"paste at end",
+		"#define J(a) a ##\n",
+		"test:1: '##' cannot appear at either end of definition for macro: J",
+	},
+	{
+		"stringify non-argument",
+		"#define S(x) #y\n",
+		"test:1: '#' is not followed by an argument in definition for macro: S",
+	},
+	{
+		"__VA_ARGS__ in non-variadic macro",
+		"#define A(x) __VA_ARGS__\n",
+		"test:1: __VA_ARGS__ used in definition of non-variadic macro: A",
+	},
+	{
+		"ellipsis not last",
+		"#define A(..., x) x\n",
+		"test:1:14: bad syntax in definition for macro: A",
+	},
+	{
+		"too few arguments",
+		"#define A(x, y) x y\n\nA(1)\n",
+		"test:3:4: too few arguments for macro: A (macro A defined at test:1)",
+	},
+	{
+		"too many arguments",
+		"#define A(x) x\nA(1, 2)\n",
+		"test:2:7: too many arguments for macro: A (macro A defined at test:1)",
+	},
+	{
+		"unterminated arguments",
+		"#define A(x) x\nA(1\n",
+		"test:2: unterminated arg list invoking macro: A (macro A defined at test:1)",
+	},
+}
+
+func TestMacros(t *testing.T) {
+	for _, test := range macroTests {
+		if got := lexMacros(test.input); got != test.output {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.output)
+		}
+	}
+}
+
+// lexMacros preprocesses the input and returns the resulting tokens
+// separated by periods, or the first error reported.
+func lexMacros(input string) string {
+	return lex("test", strings.NewReader(input))
+}
+
+// lex is like lexMacros but reads the named source from r.
+func lex(name string, r io.Reader) (result string) {
+	diag := &Diagnostics{}
+	ctxt := liblink.Linknew(LookupArch("amd64").LinkArch)
+	in := NewLexer(name, r, ctxt, diag, &Options{})
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(bailout); !ok {
+				panic(e)
+			}
+			result = diag.List[0].String()
+		}
+	}()
+	var words []string
+	for tok := in.Next(); tok != scanner.EOF; tok = in.Next() {
+		words = append(words, in.Text())
+	}
+	return strings.Join(words, ".")
+}
+
+var ifTests = []struct {
+	name   string
+	input  string
+	output string // Tokens separated by '.', or the error message.
+}{
+	{
+		"if true",
+		"#if 1\nA\n#endif\n",
+		"A.\n",
+	},
+	{
+		"if false",
+		"#if 0\nA\n#endif\nB\n",
+		"B.\n",
+	},
+	{
+		"defined",
+		"#define X 1\n#if defined(X) && !defined Y\nA\n#else\nB\n#endif\n",
+		"A.\n",
+	},
+	{
+		"macro values",
+		"#define N 4\n#if N*2 == 8 && (N << 1) > 7 && N % 3 == 1\nA\n#endif\n",
+		"A.\n",
+	},
+	{
+		"function-like macro",
+		"#define TWICE(x) ((x)*2)\n#if TWICE(3) != 6\nA\n#else\nB\n#endif\n",
+		"B.\n",
+	},
+	{
+		"undefined identifier",
+		"#if UNDEFINED\nA\n#else\nB\n#endif\n",
+		"B.\n",
+	},
+	{
+		"precedence",
+		"#if 1 + 2 * 3 == 7 && 1 | 2 ^ 3 == 1 && -1 < 0 && ~0 == -1 && 'a' == 97\nA\n#endif\n",
+		"A.\n",
+	},
+	{
+		"conditional",
+		"#if (0 ? 1/0 : 2) == 2\nA\n#endif\n",
+		"A.\n",
+	},
+	{
+		"elif chain",
+		"#define ARCH 2\n#if ARCH == 1\nA\n#elif ARCH == 2\nB\n#elif ARCH >= 2\nC\n#else\nD\n#endif\n",
+		"B.\n",
+	},
+	{
+		"elif else",
+		"#if 0\nA\n#elif 0\nB\n#else\nC\n#endif\n",
+		"C.\n",
+	},
+	{
+		"elif not evaluated",
+		"#if 1\nA\n#elif 1/0\nB\n#endif\n",
+		"A.\n",
+	},
+	{
+		"short circuit",
+		"#if 0 && 1/0 || 1 || 1/0\nA\n#endif\n",
+		"A.\n",
+	},
+	{
+		"nested in skipped text",
+		"#if 0\n#ifdef X\nA\n#else\nB\n#endif\nC\n#else\nD\n#endif\n",
+		"D.\n",
+	},
+	{
+		"nested",
+		"#if 1\n#if 0\nA\n#elif 1\nB\n#endif\n#endif\n",
+		"B.\n",
+	},
+	{
+		"macros not expanded in skipped text",
+		"#define F(x) x\n#if 0\nF\n#endif\nG\n",
+		"G.\n",
+	},
+	{
+		"definitions in skipped text",
+		"#ifdef NOTDEF\n#define S(x) #x\n#define J(a, b) a ## b\n#define L \\\n\t# x\n#endif\nA\n",
+		"A.\n",
+	},
+	{
+		"conditions in skipped text",
+		"#if 0\n#if # x\n#endif\n#endif\nA\n",
+		"A.\n",
+	},
+	{
+		"division by zero",
+		"#if 1/0\n#endif\n",
+		"test:1: division by zero in #if expression",
+	},
+	{
+		"missing expression",
+		"#if\n#endif\n",
+		"test:1: missing expression after #if",
+	},
+	{
+		"trailing junk",
+		"#if 1 2\n#endif\n",
+		"test:1: unexpected \"2\" in #if expression",
+	},
+	{
+		"missing paren",
+		"#if (1\n#endif\n",
+		"test:1: missing ')' in #if expression",
+	},
+	{
+		"elif after else",
+		"#if 0\n#else\n#elif 1\n#endif\n",
+		"test:3:2: #elif after #else",
+	},
+	{
+		"unmatched elif",
+		"#elif 1\n",
+		"test:1:2: unmatched #elif",
+	},
+	{
+		"unterminated",
+		"#if 0\nA\n",
+		"test:3:1: unterminated #if",
+	},
+}
+
+func TestIf(t *testing.T) {
+	for _, test := range ifTests {
+		if got := lexMacros(test.input); got != test.output {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.output)
+		}
+	}
+}
+
+var guardTests = []struct {
+	input string
+	guard string
+}{
+	{"#ifndef G\n#define G\nA\n#endif\n", "G"},
+	{"// Comment.\n\n#ifndef G\n#define G 1\n#ifdef X\nA\n#else\nB\n#endif\n#endif // G\n\n", "G"},
+	{"#ifndef G\n#define G\n#endif", "G"},
+	{"#ifndef G\n#define H\n#endif\n", ""},
+	{"#ifdef G\n#define G\n#endif\n", ""},
+	{"#ifndef G\n#define G\n#else\nA\n#endif\n", ""},
+	{"#ifndef G\n#define G\n#endif\nA\n", ""},
+	{"A\n#ifndef G\n#define G\n#endif\n", ""},
+	{"#ifndef G\n#define G\n", ""},
+}
+
+func TestIncludeGuard(t *testing.T) {
+	for _, test := range guardTests {
+		if got := includeGuard([]byte(test.input)); got != test.guard {
+			t.Errorf("includeGuard(%q) = %q; want %q", test.input, got, test.guard)
+		}
+	}
+}
+
+var includeTests = []struct {
+	name   string
+	files  map[string]string // Input files; main.s is assembled.
+	output string
+}{
+	{
+		"guard",
+		map[string]string{
+			"main.s": "#include \"a.h\"\n#include \"a.h\"\nX\n",
+			"a.h":    "#ifndef A_H\n#define A_H\nA\n#endif\n",
+		},
+		"A.\n.X.\n",
+	},
+	{
+		"pragma once",
+		map[string]string{
+			"main.s": "#include \"a.h\"\n#include \"a.h\"\nX\n",
+			"a.h":    "#pragma once\nA\n",
+		},
+		"A.\n.X.\n",
+	},
+	{
+		"unguarded",
+		map[string]string{
+			"main.s": "#include \"a.h\"\n#include \"a.h\"\n",
+			"a.h":    "A\n",
+		},
+		"A.\n.A.\n",
+	},
+	{
+		"guarded cycle",
+		map[string]string{
+			"main.s": "#include \"a.h\"\nX\n",
+			"a.h":    "#ifndef A_H\n#define A_H\n#include \"b.h\"\nA\n#endif\n",
+			"b.h":    "#ifndef B_H\n#define B_H\n#include \"a.h\"\nB\n#endif\n",
+		},
+		"B.\n.A.\n.X.\n",
+	},
+	{
+		"cycle",
+		map[string]string{
+			"main.s": "#include \"a.h\"\n",
+			"a.h":    "#include \"b.h\"\n",
+			"b.h":    "#include \"a.h\"\n",
+		},
+		"b.h:1: #include cycle: main.s includes a.h includes b.h includes a.h",
+	},
+	{
+		"self",
+		map[string]string{
+			"main.s": "#include \"main.s\"\n",
+		},
+		"main.s:1: #include cycle: main.s includes main.s",
+	},
+}
+
+func TestInclude(t *testing.T) {
+	for _, test := range includeTests {
+		dir, err := ioutil.TempDir("", "asmtest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for name, data := range test.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		main := filepath.Join(dir, "main.s")
+		got := lex(main, strings.NewReader(test.files["main.s"]))
+		got = strings.Replace(got, dir+string(filepath.Separator), "", -1)
+		if got != test.output {
+			t.Errorf("%s: got %q; want %q", test.name, got, test.output)
+		}
+	}
+}
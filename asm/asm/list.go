@@ -0,0 +1,603 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file prints Progs back in Go assembler syntax. The output can be
+// assembled again to produce the same instructions.
+
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rsc/c2go/liblink/arm"
+	"code.google.com/p/rsc/c2go/liblink/ppc64"
+)
+
+// A listing is the text of an assembled program, one line per Prog.
+// The text is formatted before liblink assembles the Progs, because
+// assembly rewrites them (it adds the stack check to each function, for
+// instance), but the PCs and encoded bytes are only known afterwards.
+type listing struct {
+	arch      *Arch
+	registers map[int]string // Register names, indexed by Arch.registers value.
+	labels    map[*liblink.Prog]string
+	lines     []listLine
+}
+
+type listLine struct {
+	prog  *liblink.Prog
+	label string // Label defined at this Prog, if any.
+	text  string
+}
+
+// newListing formats the list of Progs starting at first.
+func newListing(arch *Arch, first *liblink.Prog) *listing {
+	l := &listing{
+		arch:      arch,
+		registers: make(map[int]string),
+		labels:    make(map[*liblink.Prog]string),
+	}
+	for name, r := range arch.registers {
+		// Where a register has several names, as R10 and g on ARM, use the first alphabetically.
+		if old, ok := l.registers[r]; !ok || name < old {
+			l.registers[r] = name
+		}
+	}
+	if _, ok := l.registers[arch.SP]; !ok {
+		// On x86 the name SP is taken by the pseudo-register, which becomes the hardware one.
+		l.registers[arch.SP] = "SP"
+	}
+	// Name the branch targets, in program order.
+	targets := make(map[*liblink.Prog]bool)
+	for p := first; p != nil; p = p.Link {
+		if t := l.branchTarget(first, p); t != nil {
+			targets[t] = true
+		}
+	}
+	for p := first; p != nil; p = p.Link {
+		if targets[p] {
+			l.labels[p] = fmt.Sprintf("L%d", len(l.labels)+1)
+		}
+	}
+	for p := first; p != nil; p = p.Link {
+		l.lines = append(l.lines, listLine{
+			prog:  p,
+			label: l.labels[p],
+			text:  l.progString(first, p),
+		})
+	}
+	return l
+}
+
+// branchTarget returns the Prog that p branches to within the program, or nil.
+// Until liblink resolves them, branches such as JMP 2(PC) hold the PC of the
+// target, as counted by the parser, rather than the target itself.
+func (l *listing) branchTarget(first, p *liblink.Prog) *liblink.Prog {
+	if p.To.Typ != l.arch.D_BRANCH || p.To.Sym != nil {
+		return nil
+	}
+	if p.To.U.Branch != nil {
+		return p.To.U.Branch
+	}
+	for q := first; q != nil; q = q.Link {
+		if q.Pc == p.To.Offset {
+			return q
+		}
+	}
+	return nil
+}
+
+// write prints the listing to w. Each instruction is annotated with its PC
+// within its function and the bytes it assembled to.
+func (l *listing) write(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	var fn *liblink.LSym // The function being listed.
+	var pcs []int64      // The PCs of all the Progs in fn, after assembly.
+	for _, line := range l.lines {
+		p := line.prog
+		if line.label != "" {
+			fmt.Fprintf(b, "%s:\n", line.label)
+		}
+		switch p.As {
+		case l.arch.ADATA, l.arch.AGLOBL:
+			// Not part of any function.
+			fmt.Fprintf(b, "%s\n", line.text)
+			continue
+		case l.arch.ATEXT:
+			fn = p.From.Sym
+			pcs = functionPCs(l.arch, fn)
+			fmt.Fprintf(b, "%s\t// %#04x\n", line.text, p.Pc)
+			continue
+		}
+		fmt.Fprintf(b, "\t%s\t// %#04x", line.text, p.Pc)
+		if code := progBytes(fn, pcs, p.Pc); len(code) > 0 {
+			fmt.Fprintf(b, " % x", code)
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	return b.Flush()
+}
+
+// functionPCs returns the sorted PCs of the Progs of the assembled function fn.
+func functionPCs(arch *Arch, fn *liblink.LSym) []int64 {
+	var pcs []int64
+	if fn == nil {
+		return nil
+	}
+	for p := fn.Text; p != nil; p = p.Link {
+		if p != fn.Text && p.As == arch.ATEXT {
+			break
+		}
+		pcs = append(pcs, p.Pc)
+	}
+	sort.Sort(int64Slice(pcs))
+	return pcs
+}
+
+// progBytes returns the machine code of the Prog at pc in function fn: the bytes
+// up to the next PC at which any Prog, including those added by liblink, starts.
+func progBytes(fn *liblink.LSym, pcs []int64, pc int64) []byte {
+	if fn == nil || pc < 0 || pc >= int64(len(fn.P)) {
+		return nil
+	}
+	end := int64(len(fn.P))
+	i := sort.Search(len(pcs), func(i int) bool { return pcs[i] > pc })
+	if i < len(pcs) && pcs[i] < end {
+		end = pcs[i]
+	}
+	return fn.P[pc:end]
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// progString returns the text of p, without its label.
+func (l *listing) progString(first, p *liblink.Prog) string {
+	arch := l.arch
+	name := fmt.Sprintf("A%d", p.As)
+	if p.As >= 0 && p.As < len(arch.anames) {
+		name = arch.anames[p.As]
+	}
+	switch p.As {
+	case arch.ATEXT:
+		return fmt.Sprintf("%s\t%s, %d, %s", name, l.addrString(&p.From), l.flag(p), l.frameString(&p.To))
+	case arch.ADATA:
+		return fmt.Sprintf("%s\t%s/%d, %s", name, l.addrString(&p.From), l.flag(p), l.addrString(&p.To))
+	case arch.AGLOBL:
+		return fmt.Sprintf("%s\t%s, %d, %s", name, l.addrString(&p.From), l.flag(p), l.addrString(&p.To))
+	}
+	if arch.Thechar == '5' {
+		name += armSuffixString(p.Scond)
+	}
+	var ops []string
+	if arch.Thechar == '9' && arch.jumps[name] && p.Reg != arch.regNone {
+		// BC BO, BI, target or BEQ CR1, target; see asmJump.
+		if p.From.Typ == ppc64.D_CONST {
+			ops = append(ops, fmt.Sprint(p.From.Offset), fmt.Sprint(p.Reg))
+		} else {
+			ops = append(ops, l.regString(ppc64.D_CREG, p.Reg))
+		}
+		return name + "\t" + strings.Join(append(ops, l.targetString(first, p)), ", ")
+	}
+	if shape, ok := l.matchShape(p); ok {
+		for _, s := range shape {
+			ops = append(ops, l.slotString(first, p, s))
+		}
+	} else {
+		// Jumps, mostly: print the parts that are set in the usual order.
+		if p.From.Typ != arch.D_NONE {
+			ops = append(ops, l.operandString(p, &p.From))
+		}
+		if p.Reg != arch.regNone {
+			ops = append(ops, l.regString(l.middleRegisterType(p), p.Reg))
+		}
+		if p.From3.Typ != arch.D_NONE {
+			ops = append(ops, l.addrString(&p.From3))
+		}
+		if p.To.Typ != arch.D_NONE {
+			ops = append(ops, l.targetString(first, p))
+		}
+	}
+	if len(ops) == 0 {
+		return name
+	}
+	return name + "\t" + strings.Join(ops, ", ")
+}
+
+// The parts of a Prog that can hold operands. A shape fits a Prog if its slots
+// fill exactly the parts that are set.
+const (
+	partFrom = 1 << iota
+	partTo
+	partReg
+	partFrom3
+	partToOffset
+	partFromIndex
+	partRegReg2
+)
+
+// slotParts records which parts of a Prog each slot fills.
+var slotParts = [...]int{
+	slotFrom:      partFrom,
+	slotTo:        partTo,
+	slotReg:       partReg,
+	slotFrom3:     partFrom3,
+	slotToConst:   partToOffset,
+	slotToImm:     partToOffset,
+	slotFromIndex: partFromIndex,
+	slotToPair:    partTo | partFromIndex,
+	slotToReg:     partRegReg2,
+	slotToReg2:    partRegReg2,
+}
+
+// parts returns the set of parts of p that are set.
+func (l *listing) parts(p *liblink.Prog) int {
+	arch := l.arch
+	var parts int
+	if p.From.Typ != arch.D_NONE {
+		parts |= partFrom
+	}
+	if p.Reg != arch.regNone {
+		parts |= partReg
+	}
+	if p.From3.Typ != arch.D_NONE {
+		parts |= partFrom3
+	}
+	switch {
+	case arch.Thechar == '5' && p.To.Typ == arm.D_REGREG2:
+		parts |= partRegReg2
+	case p.To.Typ != arch.D_NONE:
+		parts |= partTo
+	}
+	if arch.Thechar == '6' || arch.Thechar == '8' {
+		if l.isX86Register(p.To.Typ) && p.To.Offset != 0 {
+			parts |= partToOffset
+		}
+		// From.Index of an address holds the kind of symbol; see addrToAddr.
+		if p.From.Typ != arch.D_ADDR && p.From.Index != arch.D_NONE && p.From.Scale == 0 {
+			parts |= partFromIndex
+		}
+	}
+	return parts
+}
+
+// matchShape returns the first of the shapes of p's instruction that fits p.
+func (l *listing) matchShape(p *liblink.Prog) (shape, bool) {
+	parts := l.parts(p)
+	for _, s := range l.arch.operandShapes(p.As) {
+		fill := 0
+		for _, slot := range s {
+			fill |= slotParts[slot]
+		}
+		if fill == parts {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// slotString returns the text of the operand of p in slot s.
+func (l *listing) slotString(first, p *liblink.Prog, s slot) string {
+	switch s {
+	case slotFrom:
+		return l.operandString(p, &p.From)
+	case slotTo:
+		return l.targetString(first, p)
+	case slotReg:
+		return l.regString(l.middleRegisterType(p), p.Reg)
+	case slotFrom3:
+		return l.addrString(&p.From3)
+	case slotToConst:
+		return fmt.Sprint(p.To.Offset)
+	case slotToImm:
+		return fmt.Sprintf("$%d", p.To.Offset)
+	case slotFromIndex:
+		return l.regString(p.From.Index, 0)
+	case slotToPair:
+		return l.targetString(first, p) + ":" + l.regString(p.From.Index, 0)
+	case slotToReg:
+		return l.regString(arm.D_REG, p.To.Reg)
+	case slotToReg2:
+		return l.regString(arm.D_REG, int(p.To.Offset))
+	}
+	return fmt.Sprintf("?slot%d", s)
+}
+
+// targetString returns the text of the destination operand of p, which
+// for a branch within the program is the label of the target.
+func (l *listing) targetString(first, p *liblink.Prog) string {
+	if t := l.branchTarget(first, p); t != nil {
+		return l.labels[t]
+	}
+	return l.operandString(p, &p.To)
+}
+
+// operandString returns the text of the operand a of p.
+func (l *listing) operandString(p *liblink.Prog, a *liblink.Addr) string {
+	if l.arch.Thechar == '5' && p.As == arm.AMOVM && a.Typ == arm.D_CONST && a.Sym == nil {
+		// The register list of MOVM is stored as a bit mask.
+		return l.armRegListString(a.Offset)
+	}
+	return l.addrString(a)
+}
+
+// flag returns the flag operand of TEXT and GLOBL, or the size of DATA; see setFlag.
+func (l *listing) flag(p *liblink.Prog) int {
+	switch l.arch.Thechar {
+	case '5', '9':
+		return p.Reg
+	}
+	return int(p.From.Scale)
+}
+
+// frameString returns the frame and argument sizes of TEXT, as in $16-8.
+// See asmText for the encodings.
+func (l *listing) frameString(a *liblink.Addr) string {
+	switch l.arch.Thechar {
+	case '5', '8':
+		return fmt.Sprintf("$%d-%d", a.Offset, a.Offset2)
+	case '9':
+		return fmt.Sprintf("$%d-%d", int32(a.Offset), a.Offset>>32)
+	}
+	return fmt.Sprintf("$%d-%d", a.Offset&0xffffffff, a.Offset>>32)
+}
+
+// middleRegisterType returns the type of the register stored in Prog.Reg on the
+// RISC machines. Only its number is stored, so take the type from the neighboring
+// operands: ADDD F1, F2, F3 has floating-point registers throughout.
+func (l *listing) middleRegisterType(p *liblink.Prog) int {
+	var reg, freg, creg int
+	switch l.arch.Thechar {
+	case '5':
+		reg, freg, creg = arm.D_REG, arm.D_FREG, -1
+	case '9':
+		reg, freg, creg = ppc64.D_REG, ppc64.D_FREG, ppc64.D_CREG
+	default:
+		return 0
+	}
+	for _, typ := range []int{p.From.Typ, p.To.Typ} {
+		switch typ {
+		case reg, freg, creg:
+			return typ
+		}
+	}
+	return reg
+}
+
+// isX86Register reports whether the x86 address type is a plain register.
+func (l *listing) isX86Register(typ int) bool {
+	return typ >= 0 && typ < l.arch.D_NONE
+}
+
+// regString returns the name of a register. On x86 the type is the register;
+// on the RISC machines the type and number together identify it.
+func (l *listing) regString(typ, num int) string {
+	r := typ
+	if l.arch.Thechar == '5' || l.arch.Thechar == '9' {
+		r = riscRegister(typ, num)
+	}
+	if name, ok := l.registers[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("?reg%d.%d", typ, num)
+}
+
+// symString returns the text of a symbolic reference such as foo<>+4(SB).
+// The kind is D_EXTERN, D_STATIC, D_AUTO or D_PARAM.
+func (l *listing) symString(sym *liblink.LSym, kind int, offset int64) string {
+	arch := l.arch
+	var base string
+	switch kind {
+	case arch.D_EXTERN, arch.D_STATIC:
+		base = "SB"
+	case arch.D_AUTO:
+		base = "SP"
+	case arch.D_PARAM:
+		base = "FP"
+	default:
+		base = fmt.Sprintf("?kind%d", kind)
+	}
+	if sym == nil {
+		return fmt.Sprintf("%d(%s)", offset, base)
+	}
+	// Symbols are recorded with a period for the middle dot, by linkName; restore it.
+	s := strings.Replace(sym.Name, ".", "·", -1)
+	if kind == arch.D_STATIC {
+		s += "<>"
+	}
+	if offset != 0 {
+		s += fmt.Sprintf("%+d", offset)
+	}
+	return s + "(" + base + ")"
+}
+
+// addrString returns the text of the operand a.
+func (l *listing) addrString(a *liblink.Addr) string {
+	arch := l.arch
+	switch a.Typ {
+	case arch.D_FCONST:
+		return "$" + floatString(a.U.Dval)
+	case arch.D_SCONST:
+		return "$" + strconv.Quote(a.U.Sval)
+	case arch.D_BRANCH:
+		if a.Sym != nil {
+			return l.symString(a.Sym, arch.D_EXTERN, a.Offset)
+		}
+		return fmt.Sprintf("%d(PC)", a.Offset)
+	}
+	switch arch.Thechar {
+	case '5':
+		return l.armAddrString(a)
+	case '9':
+		return l.ppc64AddrString(a)
+	}
+	return l.x86AddrString(a)
+}
+
+// x86AddrString is the x86 version of addrString; it inverts addrToAddr.
+func (l *listing) x86AddrString(a *liblink.Addr) string {
+	arch := l.arch
+	var s string
+	switch typ := a.Typ; {
+	case typ == arch.D_CONST:
+		return fmt.Sprintf("$%d", a.Offset)
+	case typ == arch.D_CONST2:
+		return fmt.Sprintf("$%d-%d", a.Offset, a.Offset2)
+	case typ == arch.D_ADDR:
+		// The Index field holds the symbol kind, or the type of the memory operand.
+		if a.Sym == nil && a.Index >= arch.D_INDIR {
+			mem := *a
+			mem.Typ, mem.Index = a.Index, arch.D_NONE
+			return "$" + l.x86AddrString(&mem)
+		}
+		return "$" + l.symString(a.Sym, a.Index, a.Offset)
+	case typ == arch.D_EXTERN, typ == arch.D_STATIC, typ == arch.D_AUTO, typ == arch.D_PARAM:
+		s = l.symString(a.Sym, typ, a.Offset)
+	case l.isX86Register(typ):
+		return l.regString(typ, 0)
+	case typ == arch.D_INDIR+arch.D_NONE:
+		// Absolute address, perhaps indexed.
+		s = fmt.Sprint(a.Offset)
+	case typ >= arch.D_INDIR && l.isX86Register(typ-arch.D_INDIR):
+		if a.Offset != 0 {
+			s = fmt.Sprint(a.Offset)
+		}
+		s += "(" + l.regString(typ-arch.D_INDIR, 0) + ")"
+	default:
+		return fmt.Sprintf("?type%d", typ)
+	}
+	if a.Index != arch.D_NONE && a.Scale != 0 {
+		s += fmt.Sprintf("(%s*%d)", l.regString(a.Index, 0), a.Scale)
+	}
+	return s
+}
+
+// armAddrString is the ARM version of addrString; it inverts armAddrToAddr.
+func (l *listing) armAddrString(a *liblink.Addr) string {
+	switch a.Typ {
+	case arm.D_CONST:
+		if a.Sym != nil || a.Name != arm.D_NONE || a.Reg != arm.NREG {
+			// The address of a memory operand.
+			return "$" + l.riscMemString(a, arm.D_REG, arm.NREG)
+		}
+		return fmt.Sprintf("$%d", a.Offset)
+	case arm.D_REG, arm.D_FREG, arm.D_PSR, arm.D_FPCR:
+		return l.regString(a.Typ, a.Reg)
+	case arm.D_SHIFT:
+		return l.armShiftString(a.Offset)
+	case arm.D_REGREG:
+		return fmt.Sprintf("(%s, %s)", l.regString(arm.D_REG, a.Reg), l.regString(arm.D_REG, int(a.Offset)))
+	case arm.D_OREG:
+		return l.riscMemString(a, arm.D_REG, arm.NREG)
+	}
+	return fmt.Sprintf("?type%d", a.Typ)
+}
+
+// armShiftString returns the text of a shifted register; see registerShift for the encoding.
+func (l *listing) armShiftString(shift int64) string {
+	s := l.regString(arm.D_REG, int(shift&15))
+	s += []string{"<<", ">>", "->", "@>"}[shift>>5&3]
+	if shift&(1<<4) != 0 {
+		return s + l.regString(arm.D_REG, int(shift>>8&15))
+	}
+	return s + fmt.Sprint(shift>>7&31)
+}
+
+// armRegListString returns the text of an ARM register list, such as [R0-R3,R5],
+// from its bit mask; see registerList.
+func (l *listing) armRegListString(mask int64) string {
+	var regs []string
+	for r := 0; r < 16; r++ {
+		if mask&(1<<uint(r)) == 0 {
+			continue
+		}
+		hi := r
+		for hi+1 < 16 && mask&(1<<uint(hi+1)) != 0 {
+			hi++
+		}
+		s := l.regString(arm.D_REG, r)
+		if hi > r {
+			s += "-" + l.regString(arm.D_REG, hi)
+		}
+		regs = append(regs, s)
+		r = hi
+	}
+	return "[" + strings.Join(regs, ",") + "]"
+}
+
+// armSuffixString returns the suffixes, such as .EQ or .S, for the Scond of an ARM instruction.
+func armSuffixString(scond int) string {
+	s := ""
+	if cond := scond & arm.C_SCOND; cond != armAL {
+		for name, c := range armConditions {
+			// Use the canonical names, not the aliases HS and LO.
+			if c == cond && name != "HS" && name != "LO" {
+				s += "." + name
+			}
+		}
+	}
+	for _, suffix := range []string{"S", "P", "W", "U"} {
+		if scond&armSuffixes[suffix] != 0 {
+			s += "." + suffix
+		}
+	}
+	return s
+}
+
+// ppc64AddrString is the ppc64 version of addrString; it inverts ppc64AddrToAddr.
+func (l *listing) ppc64AddrString(a *liblink.Addr) string {
+	switch a.Typ {
+	case ppc64.D_CONST:
+		if a.Sym != nil || a.Name != ppc64.D_NONE || a.Reg != ppc64.NREG {
+			// The address of a memory operand.
+			return "$" + l.riscMemString(a, ppc64.D_REG, ppc64.NREG)
+		}
+		return fmt.Sprintf("$%d", a.Offset)
+	case ppc64.D_REG, ppc64.D_FREG, ppc64.D_CREG, ppc64.D_MSR, ppc64.D_FPSCR:
+		return l.regString(a.Typ, a.Reg)
+	case ppc64.D_SPR:
+		return l.regString(a.Typ, int(a.Offset))
+	case ppc64.D_OREG:
+		s := l.riscMemString(a, ppc64.D_REG, ppc64.NREG)
+		if a.Scale != 0 {
+			s += "(" + l.regString(ppc64.D_REG, int(a.Scale)) + ")"
+		}
+		return s
+	}
+	return fmt.Sprintf("?type%d", a.Typ)
+}
+
+// riscMemString returns the text of a D_OREG memory reference on the RISC machines.
+func (l *listing) riscMemString(a *liblink.Addr, regType, regNone int) string {
+	if a.Name != l.arch.D_NONE {
+		return l.symString(a.Sym, a.Name, a.Offset)
+	}
+	if a.Reg == regNone {
+		// Absolute address.
+		return fmt.Sprint(a.Offset)
+	}
+	s := ""
+	if a.Offset != 0 {
+		s = fmt.Sprint(a.Offset)
+	}
+	return s + "(" + l.regString(regType, a.Reg) + ")"
+}
+
+// floatString formats f so that it scans as a floating-point constant.
+func floatString(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,164 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden listings in testdata")
+
+// list assembles src and returns its listing.
+func list(t *testing.T, arch, name string, src []byte) string {
+	var buf bytes.Buffer
+	obj, diags := Assemble(arch, name, bytes.NewReader(src), Options{List: &buf})
+	if obj == nil {
+		t.Fatalf("failed to assemble %s: %v", name, diags)
+	}
+	return buf.String()
+}
+
+// testGolden checks that the listing of the named file matches the golden
+// listing beside it, x.golden for x.s; go test -update rewrites it. The comments
+// on each line, which hold the PC and machine code from liblink, are left out,
+// so the golden file records the Progs that this package builds.
+func testGolden(t *testing.T, arch, file string) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(list(t, arch, file, src), "\n")
+	for i, line := range lines {
+		if j := strings.Index(line, "\t// "); j >= 0 {
+			lines[i] = line[:j] + "\n"
+		}
+	}
+	got := strings.Join(lines, "")
+	golden := strings.TrimSuffix(file, ".s") + ".golden"
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(got), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	data, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.SplitAfter(string(data), "\n")
+	for i := 0; i < len(lines) || i < len(want); i++ {
+		var g, w string
+		if i < len(lines) {
+			g = lines[i]
+		}
+		if i < len(want) {
+			w = want[i]
+		}
+		if g != w {
+			t.Errorf("%s:%d: got %q; want %q", golden, i+1, g, w)
+			return
+		}
+	}
+}
+
+// testRoundTrip checks that the listing of the named file assembles to the same
+// program. The listing includes the machine code, so if the listings match,
+// so does the code.
+func testRoundTrip(t *testing.T, arch, file string) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := list(t, arch, file, src)
+	second := list(t, arch, "listing.s", []byte(first))
+	if first != second {
+		t.Errorf("%s: listing does not round-trip:\n%s\nbecame\n%s", file, first, second)
+	}
+}
+
+func TestListRoundTrip(t *testing.T) {
+	for _, arch := range []string{"amd64", "arm", "ppc64"} {
+		testRoundTrip(t, arch, "testdata/"+arch+".s")
+	}
+}
+
+var listTests = []struct {
+	arch  string
+	input string
+	text  string
+}{
+	{"amd64", "MOVQ $1, AX", "MOVQ\t$1, AX"},
+	{"amd64", "MOVQ x+8(FP), AX", "MOVQ\tx+8(FP), AX"},
+	{"amd64", "MOVQ 16(AX)(BX*8), CX", "MOVQ\t16(AX)(BX*8), CX"},
+	{"amd64", "MOVQ $foo(SB), AX", "MOVQ\t$foo(SB), AX"},
+	{"amd64", "MOVQ tab<>+8(SB), AX", "MOVQ\ttab<>+8(SB), AX"},
+	{"amd64", "SHLQ $4, DX:AX", "SHLQ\t$4, DX:AX"},
+	{"amd64", "SHLQ $4, AX, DX", "SHLQ\t$4, DX:AX"},
+	{"amd64", "SHLQ $4, AX", "SHLQ\t$4, AX"},
+	{"amd64", "SHRL CX, (BX)", "SHRL\tCX, (BX)"},
+	{"amd64", "CMPPS X1, X0, 4", "CMPPS\tX1, X0, 4"},
+	{"amd64", "IMUL3Q $5, AX, BX", "IMUL3Q\t$5, AX, BX"},
+	{"amd64", "PSHUFL $0x1b, X1, X2", "PSHUFL\t$27, X1, X2"},
+	{"amd64", "INCQ AX", "INCQ\tAX"},
+	{"amd64", "CALL runtime·morestack(SB)", "CALL\truntime·morestack(SB)"},
+	{"amd64", "MOVQ x-8(SP), AX", "MOVQ\tx-8(SP), AX"},
+	{"amd64", "MOVQ AX, 8(SP)", "MOVQ\tAX, 8(SP)"},
+	{"amd64", "MOVQ $x-8(SP), AX", "MOVQ\t$x-8(SP), AX"},
+	{"amd64", "MOVQ $8(SP), AX", "MOVQ\t$8(SP), AX"},
+	{"amd64", "MOVQ SP, AX", "MOVQ\tSP, AX"},
+	{"arm", "MOVW.EQ R1, R2", "MOVW.EQ\tR1, R2"},
+	{"arm", "SUB R1<<2, R2, R3", "SUB\tR1<<2, R2, R3"},
+	{"arm", "MULA R1, R2, R3, R4", "MULA\tR1, R2, R3, R4"},
+	{"arm", "ADDD F1, F2, F3", "ADDD\tF1, F2, F3"},
+	{"arm", "MOVM.IA [R0-R3,R5], (R1)", "MOVM.U\t[R0-R3,R5], (R1)"},
+	{"arm", "MOVW R1, -4(R13)", "MOVW\tR1, -4(R13)"},
+	{"arm", "MOVW $x-8(SP), R1", "MOVW\t$x-8(SP), R1"},
+	{"arm", "MOVW $8(R2), R1", "MOVW\t$8(R2), R1"},
+	{"ppc64", "MOVD (R3)(R4), R5", "MOVD\t(R3)(R4), R5"},
+	{"ppc64", "MOVD LR, R31", "MOVD\tLR, R31"},
+	{"ppc64", "MOVD $8(R1), R3", "MOVD\t$8(R1), R3"},
+	{"ppc64", "FMADD F1, F2, F3, F4", "FMADD\tF1, F2, F3, F4"},
+}
+
+func TestListInstruction(t *testing.T) {
+	for _, test := range listTests {
+		src := "TEXT foo(SB), 0, $0\n" + test.input + "\n"
+		lines := strings.Split(list(t, test.arch, "x.s", []byte(src)), "\n")
+		if len(lines) < 2 {
+			t.Errorf("%s %s: short listing %q", test.arch, test.input, lines)
+			continue
+		}
+		// The second line is the instruction, indented and followed by its PC.
+		text := strings.TrimPrefix(lines[1], "\t")
+		if i := strings.Index(text, "\t//"); i >= 0 {
+			text = text[:i]
+		}
+		if text != test.text {
+			t.Errorf("%s %s: got %q; want %q", test.arch, test.input, text, test.text)
+		}
+	}
+}
+
+func TestFuncdata(t *testing.T) {
+	src := "TEXT ·f(SB), 0, $0-8\nPCDATA $PCDATA_StackMapIndex, $1\nFUNCDATA $FUNCDATA_LocalsPointerMaps, x(SB)\nRET\n"
+	text := list(t, "amd64", "x.s", []byte(src))
+	for _, want := range []string{
+		"PCDATA\t$0, $1",
+		"FUNCDATA\t$1, x(SB)",
+		// Synthesized, since the function has arguments but no map for them.
+		"FUNCDATA\t$0, ·f·args_stackmap(SB)",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("listing does not contain %q:\n%s", want, text)
+		}
+	}
+	if again := list(t, "amd64", "listing.s", []byte(text)); again != text {
+		t.Errorf("listing does not round-trip:\n%s\nbecame\n%s", text, again)
+	}
+}
@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package asm
 
 /*
 	Tested with uint8s like this:
@@ -51,8 +51,7 @@ func mulOverflows(a, b uint64) bool {
 	return c/b != a
 }
 
-/*
-For the record, signed overflow:
+// Signed overflow.
 
 const mostNegative = -(mostPositive + 1)
 const mostPositive = 1<<63 - 1
@@ -91,4 +90,3 @@ func signedMulOverflows(a, b int64) bool {
 	c := a * b
 	return c/b != a
 }
-*/
@@ -0,0 +1,885 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+const (
+	rFP = -(iota + 1)
+	rSB
+	rSP
+	rPC
+)
+
+type Parser struct {
+	lex           TokenReader
+	lineNum       int
+	errorLine     int          // Line number of last error.
+	at            LexToken     // Token errors refer to: the instruction, or the start of the operand being parsed.
+	inst          LexToken     // The instruction word of the current line.
+	diag          *Diagnostics // Where errors are reported.
+	pc            int64        // virtual PC; count of Progs; doesn't advance for GLOBL or DATA.
+	input         []LexToken
+	inputPos      int
+	pendingLabels []string                 // Labels to attach to next instruction.
+	labels        map[string]*liblink.Prog // Labels of the current function; see endScope.
+	labelFuncs    map[string]string        // Function in which each label was defined.
+	numLabels     map[string]int           // Number of definitions so far of each numeric label, such as 1.
+	toPatch       []Patch                  // Jumps to labels of the current function not yet defined.
+	unresolved    []Patch                  // Jumps to labels their function does not define.
+	pcJumps       []Patch                  // Jumps such as JMP 2(PC) in the current function.
+	text          Patch                    // The current function's TEXT, for diagnostics.
+	argsMap       bool                     // Whether the current function has FUNCDATA $FUNCDATA_ArgsPointerMaps.
+	addr          []Addr                   //[]liblink.Addr
+	arch          *Arch
+	linkCtxt      *liblink.Link
+	firstProg     *liblink.Prog
+	lastProg      *liblink.Prog
+	dataAddr      map[string]int64       // Most recent address for DATA for this symbol.
+	symbols       map[string]*symbolInfo // The SB symbols defined and referred to; see symbol.
+	trace         *tracer
+	gnu           *gnuState // State of the GNU dialect; nil when reading Go syntax.
+	scond         int       // Condition and suffix bits for the current ARM instruction.
+	funcName      string    // Name of the current function; empty before the first TEXT.
+	argSize       int64     // Size of the current function's arguments, or -1 if not declared.
+}
+
+// A Patch records an instruction, usually a jump, to be checked or resolved at the end of its function.
+type Patch struct {
+	prog  *liblink.Prog
+	label string // Key in Parser.labels; see labelName.
+	fn    string // The function containing the jump.
+	file  string // Position of the jump, for diagnostics.
+	line  int
+	at    LexToken
+}
+
+func NewParser(ctxt *liblink.Link, arch *Arch, lex TokenReader, diag *Diagnostics) *Parser {
+	return &Parser{
+		linkCtxt:   ctxt,
+		arch:       arch,
+		lex:        lex,
+		diag:       diag,
+		labels:     make(map[string]*liblink.Prog),
+		labelFuncs: make(map[string]string),
+		numLabels:  make(map[string]int),
+		dataAddr:   make(map[string]int64),
+		symbols:    make(map[string]*symbolInfo),
+	}
+}
+
+func (p *Parser) errorf(format string, args ...interface{}) {
+	if p.lineNum == p.errorLine {
+		// Only one error per line.
+		return
+	}
+	p.errorLine = p.lineNum
+	if p.diag.Report(p.diagnostic(Error, format, args...)) {
+		panic(bailout{})
+	}
+}
+
+// warnf reports a warning about the current line. Warnings do not stop the assembly.
+func (p *Parser) warnf(format string, args ...interface{}) {
+	p.diag.Report(p.diagnostic(Warning, format, args...))
+}
+
+// diagnostic returns a Diagnostic positioned at the token errors refer to.
+// If a macro produced the token, the message says which.
+func (p *Parser) diagnostic(severity Severity, format string, args ...interface{}) Diagnostic {
+	msg := fmt.Sprintf(format, args...)
+	if p.at.exp != "" {
+		msg += " (" + p.at.exp + ")"
+	}
+	return Diagnostic{
+		File:     p.lex.FileName(),
+		Line:     p.lineNum,
+		Col:      p.at.col,
+		Severity: severity,
+		Msg:      msg,
+	}
+}
+
+// Parse assembles the input. It returns the list of Progs and whether
+// assembly succeeded; the errors are in the Parser's Diagnostics.
+func (p *Parser) Parse() (prog *liblink.Prog, ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, isBailout := e.(bailout); !isBailout {
+				panic(e)
+			}
+			prog, ok = nil, false
+		}
+	}()
+	for p.line() {
+	}
+	if p.gnu != nil {
+		p.gnuEndData()
+	}
+	if p.diag.ErrorCount() > 0 {
+		return nil, false
+	}
+	p.endFunction()
+	p.patch()
+	p.checkSymbols()
+	if p.diag.ErrorCount() > 0 {
+		return nil, false
+	}
+	return p.firstProg, true
+}
+
+// WORD op {, op} '\n'
+func (p *Parser) line() bool {
+	// Skip newlines.
+	var tok Token
+	for {
+		tok = p.lex.Next()
+		// We save the line number here so error messages from this instruction
+		// are labeled with this line. Otherwise we complain after we've absorbed
+		// the terminating newline and the line numbers are off by one in errors.
+		p.lineNum = p.lex.Line()
+		p.at = p.token(tok)
+		switch tok {
+		case '\n':
+			continue
+		case scanner.EOF:
+			return false
+		}
+		break
+	}
+	if p.gnu != nil {
+		return p.gnuLine(tok)
+	}
+	if tok == scanner.Int {
+		// A numeric local label: 1:.
+		word := p.lex.Text()
+		if p.lex.Next() == ':' {
+			p.checkLabel()
+			p.numLabels[word]++
+			p.pendingLabels = append(p.pendingLabels, numericLabel(word, p.numLabels[word]))
+			p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "label %s:", word)
+			return true
+		}
+		p.errorf("expected identifier, found %q", word)
+		return false
+	}
+	// First item must be an identifier.
+	if tok != scanner.Ident {
+		p.errorf("expected identifier, found %q", p.lex.Text())
+		return false // Might as well stop now.
+	}
+	word := p.lex.Text()
+	p.inst = p.at
+	cond := ""
+	operands := make([][]LexToken, 0, 3)
+	// Zero or more comma-separated operands, one per loop.
+	nesting := 0  // Commas inside () or [] do not separate operands.
+	first := true // Permit ':' to define this as a label.
+	for tok != '\n' && tok != ';' {
+		// Process one operand.
+		items := make([]LexToken, 0, 3)
+		for {
+			tok = p.lex.Next()
+			if first {
+				if tok == ':' {
+					p.checkLabel()
+					p.pendingLabels = append(p.pendingLabels, word)
+					p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "label %s:", word)
+					return true
+				}
+				// Suffixes such as the ARM condition in MOVW.EQ.
+				for tok == '.' {
+					tok = p.lex.Next()
+					if tok != scanner.Ident {
+						p.errorf("expected identifier after '.' in %s, found %s", word, p.lex.Text())
+						break
+					}
+					cond += "." + p.lex.Text()
+					tok = p.lex.Next()
+				}
+				first = false
+			}
+			if tok == scanner.EOF {
+				p.errorf("unexpected EOF")
+				return false
+			}
+			if tok == '\n' || tok == ';' || (tok == ',' && nesting == 0) {
+				break
+			}
+			switch tok {
+			case '(', '[':
+				nesting++
+			case ')', ']':
+				nesting--
+			}
+			items = append(items, p.token(tok))
+		}
+		if len(items) > 0 {
+			operands = append(operands, items)
+		} else if len(operands) > 0 {
+			// Had a comma but nothing after.
+			p.errorf("missing operand")
+		}
+	}
+	if p.trace.enabled(TraceParse) {
+		p.trace.printf(TraceParse, p.lex.FileName(), p.lineNum, "%s", statementString(word+cond, operands))
+	}
+	switch {
+	case p.arch.Thechar == '5':
+		p.scond = p.armConditionCode(word, cond)
+	case cond != "":
+		p.errorf("unexpected suffix %s on %s", cond, word)
+	}
+	i := p.arch.pseudos[word]
+	if i != 0 {
+		p.pseudo(i, word, operands)
+		return true
+	}
+	i = p.arch.instructions[word]
+	if i != 0 {
+		p.instruction(i, word, operands)
+		return true
+	}
+	p.errorf("unrecognized instruction %s", word)
+	return true
+}
+
+// checkLabel reports a label defined before the first TEXT, which has no function to be in.
+func (p *Parser) checkLabel() {
+	if p.funcName == "" {
+		p.errorf("label outside of function")
+	}
+}
+
+// statementString formats a statement for the trace, with its operands bracketed
+// to show how the line was split: MOVQ [$1] [AX].
+func statementString(word string, operands [][]LexToken) string {
+	s := word
+	for _, operand := range operands {
+		s += " ["
+		for _, tok := range operand {
+			s += tok.text
+		}
+		s += "]"
+	}
+	return s
+}
+
+func (p *Parser) instruction(op int, word string, operands [][]LexToken) {
+	if p.arch.jumps[word] && len(operands) > 0 {
+		last := len(operands) - 1
+		operands[last] = p.numericTarget(operands[last])
+	}
+	p.addr = p.addr[0:0]
+	for _, op := range operands {
+		p.addr = append(p.addr, p.address(op))
+	}
+	p.at = p.inst
+	if p.arch.jumps[word] {
+		p.asmJump(op, p.addr)
+		return
+	}
+	p.asmInstruction(op, word, p.addr)
+}
+
+// numericTarget rewrites a jump target that refers to a numeric local label,
+// 1b for the most recent definition of 1 or 1f for the next, as the name of that definition.
+func (p *Parser) numericTarget(operand []LexToken) []LexToken {
+	if len(operand) != 2 || operand[0].Token != scanner.Int || operand[1].Token != scanner.Ident {
+		return operand
+	}
+	num := operand[0].text
+	n := p.numLabels[num]
+	switch operand[1].text {
+	case "b":
+		if n == 0 {
+			p.errorf("undefined label %sb", num)
+			return operand
+		}
+	case "f":
+		n++
+	default:
+		return operand
+	}
+	tok := operand[0]
+	tok.Token = scanner.Ident
+	tok.text = numericLabel(num, n)
+	return []LexToken{tok}
+}
+
+// numericLabel returns the name of the nth definition of the numeric label num.
+// It cannot clash with a label written in the source.
+func numericLabel(num string, n int) string {
+	return fmt.Sprintf("%s#%d", num, n)
+}
+
+// labelName returns the label as it is written in a jump.
+// A numeric label is only unresolved if it is a forward reference.
+func labelName(label string) string {
+	if i := strings.IndexByte(label, '#'); i >= 0 {
+		return label[:i] + "f"
+	}
+	return label
+}
+
+func (p *Parser) pseudo(op int, word string, operands [][]LexToken) {
+	switch op {
+	case p.arch.ATEXT:
+		p.asmText(word, operands)
+	case p.arch.ADATA:
+		p.asmData(word, operands)
+	case p.arch.AGLOBL:
+		p.asmGlobl(word, operands)
+	case p.arch.APCDATA:
+		p.asmPCData(word, operands)
+	case p.arch.AFUNCDATA:
+		p.asmFuncData(word, operands)
+	default:
+		p.errorf("unimplemented: %s", word)
+	}
+}
+
+// token returns the LexToken for tok, the token just read, with its position.
+func (p *Parser) token(tok Token) LexToken {
+	return LexToken{
+		Token: tok,
+		text:  p.lex.Text(),
+		col:   p.lex.Col(),
+		exp:   p.lex.Expansion(),
+	}
+}
+
+func (p *Parser) start(operand []LexToken) {
+	p.input = operand
+	p.inputPos = 0
+	if len(operand) > 0 {
+		p.at = operand[0]
+	}
+}
+
+// address parses the operand into a link address structure.
+func (p *Parser) address(operand []LexToken) Addr {
+	p.start(operand)
+	addr := Addr{at: p.at}
+	p.operand(&addr)
+	if addr.isIndirect && addr.register == rFP {
+		p.checkFP(&addr)
+	}
+	if addr.isIndirect && addr.register == rSP {
+		p.checkSP(&addr)
+	}
+	return addr
+}
+
+// checkSP diagnoses an ambiguous reference through SP. On x86, where SP is also
+// a hardware register, x-8(SP) names a local, at an offset from the pseudo-register
+// at the top of the frame, while 8(SP) without a name is an offset from the hardware
+// SP. A negative offset from the hardware SP is below the stack, so -8(SP) was almost
+// certainly meant to be a local. On the RISC machines off(SP) is always the pseudo-register.
+func (p *Parser) checkSP(a *Addr) {
+	switch p.arch.Thechar {
+	case '5', '9':
+		return
+	}
+	if a.symbol == "" && a.offset < 0 {
+		p.warnf("%d(SP) is below the hardware stack pointer; use a name like x%d(SP) for a local", a.offset, a.offset)
+	}
+}
+
+// checkFP validates a reference to the arguments, such as x+8(FP), against
+// the argument size declared by the TEXT of the enclosing function.
+func (p *Parser) checkFP(a *Addr) {
+	if a.symbol == "" {
+		p.warnf("%d(FP) has no name; use a name like x+%d(FP)", a.offset, a.offset)
+	}
+	if p.funcName == "" || p.argSize < 0 {
+		return
+	}
+	if a.offset < 0 || a.offset >= p.argSize {
+		ref := fmt.Sprintf("%d(FP)", a.offset)
+		if a.symbol != "" {
+			ref = fmt.Sprintf("%s%+d(FP)", a.symbol, a.offset)
+		}
+		p.errorf("invalid offset %s; %s has %d bytes of arguments", ref, p.funcName, p.argSize)
+	}
+}
+
+// parse (R). The opening paren is known to be there.
+// The return value states whether it was a scaled mode.
+func (p *Parser) parenRegister(a *Addr) bool {
+	p.next()
+	tok := p.next()
+	if tok.Token != scanner.Ident {
+		p.errorf("expected register, got %s", tok.text)
+	}
+	r, present := p.arch.registers[tok.text]
+	if !present {
+		p.errorf("expected register, found %s", tok.text)
+	}
+	a.isIndirect = true
+	scaled := p.peek() == '*'
+	if scaled {
+		// (R*2)
+		p.next()
+		tok := p.get(scanner.Int)
+		a.scale = p.scale(tok.text)
+		a.index = r
+	} else if a.hasRegister && p.arch.Thechar == '9' && a.index == 0 {
+		// (R1)(R2) on ppc64: register-indexed, with no scale.
+		a.index = r
+	} else {
+		if a.hasRegister {
+			p.errorf("multiple indirections")
+		}
+		a.hasRegister = true
+		a.register = r
+	}
+	p.expect(')')
+	p.next()
+	return scaled
+}
+
+// scale converts a decimal string into a valid scale factor.
+func (p *Parser) scale(s string) int8 {
+	switch s {
+	case "1", "2", "4", "8":
+		return int8(s[0] - '0')
+	}
+	p.errorf("bad scale: %s", s)
+	return 0
+}
+
+// parse (R) or (R)(R*scale). The opening paren is known to be there.
+func (p *Parser) addressMode(a *Addr) {
+	scaled := p.parenRegister(a)
+	if !scaled && p.peek() == '(' {
+		p.parenRegister(a)
+	}
+}
+
+// operand parses a general operand and stores the result in *a.
+func (p *Parser) operand(a *Addr) bool {
+	if len(p.input) == 0 {
+		p.errorf("empty operand: cannot happen")
+		return false
+	}
+	switch p.peek() {
+	case '$':
+		p.next()
+		switch p.peek() {
+		case scanner.Ident:
+			a.isImmediateAddress = true
+			p.operand(a) // TODO
+		case scanner.String:
+			a.isImmediateConstant = true
+			a.hasString = true
+			a.string = p.atos(p.next().text)
+		case scanner.Int, scanner.Float, '+', '-', '~', '(':
+			a.isImmediateConstant = true
+			if p.have(scanner.Float) {
+				a.hasFloat = true
+				a.float = p.floatExpr()
+			} else {
+				a.hasOffset = true
+				a.offset = int64(p.expr())
+			}
+			if p.peek() == '(' {
+				// $8(SP): the address of the memory operand.
+				a.isImmediateConstant = false
+				a.isImmediateAddress = true
+				p.addressMode(a)
+			}
+		default:
+			p.errorf("illegal %s in immediate operand", p.next().text)
+		}
+	case '[':
+		p.registerList(a)
+	case '*':
+		p.next()
+		tok := p.next()
+		r, present := p.arch.registers[tok.text]
+		if !present {
+			p.errorf("expected register; got %s", tok.text)
+		}
+		a.hasRegister = true
+		a.register = r
+	case '(':
+		p.next()
+		if p.peek() == scanner.Ident {
+			p.back()
+			if p.have(',') {
+				p.registerPair(a)
+				break
+			}
+			p.addressMode(a)
+			break
+		}
+		p.back()
+		fallthrough
+	case '+', '-', '~', scanner.Int, scanner.Float:
+		if p.have(scanner.Float) {
+			a.hasFloat = true
+			a.float = p.floatExpr()
+		} else {
+			a.hasOffset = true
+			a.offset = int64(p.expr())
+		}
+		if p.peek() != scanner.EOF {
+			p.expect('(')
+			p.addressMode(a)
+		}
+	case scanner.Ident:
+		tok := p.next()
+		// Either R or (most general) ident<>+4(SB)(R*scale).
+		if r, present := p.arch.registers[tok.text]; present {
+			a.hasRegister = true
+			a.register = r
+			switch p.peek() {
+			case ':':
+				// Possibly register pair: DX:AX.
+				p.next()
+				tok = p.get(scanner.Ident)
+				a.hasRegister2 = true
+				a.register2 = p.arch.registers[tok.text]
+			case LSH, RSH, ARR, ROT:
+				// Shifted register on ARM: R1<<2.
+				p.registerShift(a)
+			}
+			break
+		}
+		// Weirdness with statics: Might now have "<>".
+		if p.peek() == '<' {
+			p.next()
+			p.get('>')
+			a.isStatic = true
+		}
+		if p.peek() == '+' || p.peek() == '-' {
+			a.hasOffset = true
+			a.offset = int64(p.expr())
+		}
+		a.symbol = tok.text
+		if p.peek() == scanner.EOF {
+			break
+		}
+		// Expect (SB) or (FP)
+		p.expect('(')
+		p.parenRegister(a)
+		if a.register != rSB && a.register != rFP && a.register != rSP {
+			p.errorf("expected SB, FP, or SP offset for %s", tok.text)
+		}
+		// Possibly have scaled register (CX*8).
+		if p.peek() != scanner.EOF {
+			p.expect('(')
+			p.addressMode(a)
+		}
+	default:
+		p.errorf("unexpected %s in operand", p.next().text)
+	}
+	p.expect(scanner.EOF)
+	return true
+}
+
+// expr evaluates a constant expression, using Go's operators and precedence:
+//
+//	expr = unary | expr binop expr
+//	unary = const | '(' expr ')' | ('+' | '-' | '~') unary
+//	binop = '*' | '/' | '%' | '<<' | '>>' | '&' | '+' | '-' | '|' | '^'
+//
+// Constants are 64 bits. The result is returned as a bit pattern, to be
+// interpreted as signed or unsigned by the caller.
+func (p *Parser) expr() uint64 {
+	return p.binaryExpr(1).v
+}
+
+// An exprValue is an intermediate result of expr. Constants start out unsigned;
+// a value becomes signed when negation or subtraction makes it negative. The
+// signedness determines how overflow is checked and how >> and / behave.
+type exprValue struct {
+	v      uint64
+	signed bool // v holds an int64.
+}
+
+func (x exprValue) String() string {
+	if x.signed {
+		return fmt.Sprint(int64(x.v))
+	}
+	return fmt.Sprint(x.v)
+}
+
+// precedence returns the precedence of the binary operator, or 0 if tok is not one.
+func precedence(tok Token) int {
+	switch tok {
+	case '*', '/', '%', LSH, RSH, '&':
+		return 2
+	case '+', '-', '|', '^':
+		return 1
+	}
+	return 0
+}
+
+// binaryExpr evaluates an expression whose binary operators bind at least as
+// tightly as prec. Operators of equal precedence associate to the left.
+func (p *Parser) binaryExpr(prec int) exprValue {
+	x := p.unaryExpr()
+	for {
+		op := p.peek()
+		opPrec := precedence(op)
+		if opPrec < prec {
+			return x
+		}
+		p.next()
+		y := p.binaryExpr(opPrec + 1)
+		x = p.binaryOp(x, op, y)
+	}
+}
+
+// unaryExpr evaluates a constant, a parenthesized expression, or a unary operator applied to one.
+func (p *Parser) unaryExpr() exprValue {
+	tok := p.next()
+	switch tok.Token {
+	case '(':
+		x := p.binaryExpr(1)
+		if p.next().Token != ')' {
+			p.errorf("missing closing paren")
+		}
+		return x
+	case '+':
+		return p.unaryExpr()
+	case '-':
+		x := p.unaryExpr()
+		if x.signed && x.v == 1<<63 || !x.signed && x.v > 1<<63 {
+			p.errorf("overflow in -%s", x)
+		}
+		return exprValue{-x.v, true}
+	case '~':
+		x := p.unaryExpr()
+		return exprValue{^x.v, x.signed}
+	case scanner.Int:
+		return exprValue{p.atoi(tok.text), false}
+	}
+	p.errorf("unexpected %s evaluating expression", tok.text)
+	return exprValue{}
+}
+
+// binaryOp returns x op y. Errors are reported, and evaluation carries on with some value.
+func (p *Parser) binaryOp(x exprValue, op Token, y exprValue) exprValue {
+	signed := x.signed || y.signed
+	switch op {
+	case '&':
+		return exprValue{x.v & y.v, signed}
+	case '|':
+		return exprValue{x.v | y.v, signed}
+	case '^':
+		return exprValue{x.v ^ y.v, signed}
+	case LSH, RSH:
+		return p.shift(x, op, y)
+	}
+	if !signed {
+		return p.unsignedOp(x.v, op, y.v)
+	}
+	// Mixed operands are evaluated as signed, so the unsigned one must fit.
+	for _, z := range []exprValue{x, y} {
+		if !z.signed && z.v > mostPositive {
+			p.errorf("overflow: %s does not fit in a signed expression", z)
+			return exprValue{x.v, true}
+		}
+	}
+	return p.signedOp(int64(x.v), op, int64(y.v))
+}
+
+func (p *Parser) unsignedOp(a uint64, op Token, b uint64) exprValue {
+	switch op {
+	case '+':
+		if addOverflows(a, b) {
+			p.errorf("overflow in %d+%d", a, b)
+		}
+		return exprValue{a + b, false}
+	case '-':
+		if a >= b {
+			return exprValue{a - b, false}
+		}
+		// The result is negative, so it must fit in an int64.
+		if b-a > 1<<63 {
+			p.errorf("overflow in %d-%d", a, b)
+		}
+		return exprValue{a - b, true}
+	case '*':
+		if mulOverflows(a, b) {
+			p.errorf("overflow in %d*%d", a, b)
+		}
+		return exprValue{a * b, false}
+	case '/', '%':
+		if b == 0 {
+			p.errorf("division by zero in %d%c%d", a, op, b)
+			return exprValue{0, false}
+		}
+		if op == '/' {
+			return exprValue{a / b, false}
+		}
+		return exprValue{a % b, false}
+	}
+	p.errorf("unexpected operator %s", op)
+	return exprValue{a, false}
+}
+
+func (p *Parser) signedOp(a int64, op Token, b int64) exprValue {
+	var c int64
+	switch op {
+	case '+':
+		if signedAddOverflows(a, b) {
+			p.errorf("overflow in %d+%d", a, b)
+		}
+		c = a + b
+	case '-':
+		if signedSubOverflows(a, b) {
+			p.errorf("overflow in %d-%d", a, b)
+		}
+		c = a - b
+	case '*':
+		if signedMulOverflows(a, b) {
+			p.errorf("overflow in %d*%d", a, b)
+		}
+		c = a * b
+	case '/', '%':
+		if b == 0 {
+			p.errorf("division by zero in %d%c%d", a, op, b)
+			return exprValue{0, true}
+		}
+		if op == '%' {
+			c = a % b
+			break
+		}
+		if a == mostNegative && b == -1 {
+			p.errorf("overflow in %d/%d", a, b)
+		}
+		c = a / b
+	default:
+		p.errorf("unexpected operator %s", op)
+		c = a
+	}
+	return exprValue{uint64(c), true}
+}
+
+// shift returns x<<y or x>>y. The count must be in the range [0, 63], and a left shift
+// must not lose significant bits. A right shift of a signed value is arithmetic.
+func (p *Parser) shift(x exprValue, op Token, y exprValue) exprValue {
+	if y.signed && int64(y.v) < 0 || y.v > 63 {
+		p.errorf("shift count %s out of range", y)
+		return x
+	}
+	s := uint(y.v)
+	if op == RSH {
+		if x.signed {
+			return exprValue{uint64(int64(x.v) >> s), true}
+		}
+		return exprValue{x.v >> s, false}
+	}
+	v := x.v << s
+	if x.signed && int64(v)>>s != int64(x.v) || !x.signed && v>>s != x.v {
+		p.errorf("overflow in %s<<%d", x, s)
+	}
+	return exprValue{v, x.signed}
+}
+
+// floatExpr = fconst | '-' floatExpr | '+' floatExpr | '(' floatExpr ')'
+func (p *Parser) floatExpr() float64 {
+	tok := p.next()
+	switch tok.Token {
+	case '(':
+		v := p.floatExpr()
+		if p.next().Token != ')' {
+			p.errorf("missing closing paren")
+		}
+		return v
+	case '+':
+		return +p.floatExpr()
+	case '-':
+		return -p.floatExpr()
+	case scanner.Float:
+		return p.atof(tok.text)
+	}
+	p.errorf("unexpected %s evaluating float expression", tok.text)
+	return 0
+}
+
+func (p *Parser) atoi(str string) uint64 {
+	value, err := strconv.ParseUint(str, 0, 64)
+	if err != nil {
+		p.errorf("%s", err)
+	}
+	return value
+}
+
+func (p *Parser) atof(str string) float64 {
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		p.errorf("%s", err)
+	}
+	return value
+}
+
+func (p *Parser) atos(str string) string {
+	value, err := strconv.Unquote(str)
+	if err != nil {
+		p.errorf("%s", err)
+	}
+	return value
+}
+
+var end = LexToken{Token: scanner.EOF, text: "end"}
+
+func (p *Parser) next() LexToken {
+	if !p.more() {
+		return end
+	}
+	tok := p.input[p.inputPos]
+	p.inputPos++
+	return tok
+}
+
+func (p *Parser) back() {
+	p.inputPos--
+}
+
+func (p *Parser) peek() Token {
+	if p.more() {
+		return p.input[p.inputPos].Token
+	}
+	return scanner.EOF
+}
+
+func (p *Parser) more() bool {
+	return p.inputPos < len(p.input)
+}
+
+// get verifies that the next item has the expected type and returns it.
+func (p *Parser) get(expected Token) LexToken {
+	p.expect(expected)
+	return p.next()
+}
+
+// expect verifies that the next item has the expected type. It does not consume it.
+func (p *Parser) expect(expected Token) {
+	if p.peek() != expected {
+		p.errorf("expected %s, found %s", expected, p.next().text)
+	}
+}
+
+// have reports whether the remaining tokens contain the specified token.
+func (p *Parser) have(token Token) bool {
+	for i := p.inputPos; i < len(p.input); i++ {
+		if p.input[i].Token == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file encapsulates some of the odd characteristics of the
+// 64-bit PowerPC (PPC64) instruction set, to minimize its interaction
+// with the core of the assembler.
+
+package asm
+
+import (
+	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rsc/c2go/liblink/ppc64"
+)
+
+// ppc64AddrToAddr is the ppc64 version of addrToAddr. As on ARM, the register
+// number is kept in Addr.Reg and the symbol kind in Addr.Name. The special-purpose
+// registers (LR, CTR, XER) have type D_SPR and their SPR number in Addr.Offset,
+// and the index register of (R1)(R2) goes in Addr.Scale.
+func (p *Parser) ppc64AddrToAddr(a *Addr) liblink.Addr {
+	out := p.arch.noAddr
+	switch {
+	case a.has(addrSymbol):
+		out = p.symbolAddr(a, a.symbol)
+		if a.isImmediateAddress {
+			// $sym(SB) is the address itself.
+			out.Typ = ppc64.D_CONST
+		}
+	case a.has(addrRegister):
+		out.Offset = a.offset
+		switch a.register {
+		case rSB, rFP:
+			out.Typ = ppc64.D_OREG
+			out.Name = p.symbolType(a)
+		case rSP:
+			if a.isIndirect {
+				out.Typ = ppc64.D_OREG
+				out.Name = ppc64.D_AUTO
+			} else {
+				// Bare SP is the hardware register.
+				out.Typ = ppc64.D_REG
+				out.Reg = ppc64.REGSP
+			}
+		case rPC:
+			p.errorf("illegal use of PC")
+		default:
+			typ, num := riscRegisterType(a.register)
+			switch {
+			case typ == ppc64.D_SPR:
+				// Also the target of BR (CTR) and BL (LR), which are not memory references.
+				out.Typ = ppc64.D_SPR
+				out.Offset = int64(num)
+			case a.isIndirect:
+				if typ != ppc64.D_REG {
+					p.errorf("indirection through non-general register")
+				}
+				out.Typ = ppc64.D_OREG
+				out.Reg = num
+			default:
+				out.Typ = typ
+				out.Reg = num
+			}
+		}
+		if a.has(addrIndex) {
+			// (R1)(R2).
+			if a.offset != 0 {
+				p.errorf("indexed address cannot have an offset")
+			}
+			typ, num := riscRegisterType(a.index)
+			if typ != ppc64.D_REG {
+				p.errorf("index must be a general register")
+			}
+			out.Scale = int8(num)
+		}
+	case a.has(addrFloat):
+		out.Typ = ppc64.D_FCONST
+		out.U.Dval = a.float
+	case a.has(addrString):
+		out.Typ = ppc64.D_SCONST
+		out.U.Sval = a.string
+	case a.has(addrOffset):
+		out.Offset = a.offset
+		if a.isImmediateConstant {
+			out.Typ = ppc64.D_CONST
+		} else {
+			// Absolute memory address.
+			out.Typ = ppc64.D_OREG
+		}
+	}
+	if a.isImmediateAddress && out.Typ == ppc64.D_OREG {
+		// $8(R1) and $8(SP) are the address itself.
+		if out.Scale != 0 {
+			p.errorf("cannot take the address of an indexed operand")
+		}
+		out.Typ = ppc64.D_CONST
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"strings"
+	"testing"
+
+	"code.google.com/p/rsc/c2go/liblink/ppc64"
+)
+
+var ppc64OperandTests = []struct {
+	input  string
+	typ    int
+	reg    int
+	name   int
+	offset int64
+	scale  int8
+}{
+	{"R1", ppc64.D_REG, 1, ppc64.D_NONE, 0, 0},
+	{"R31", ppc64.D_REG, 31, ppc64.D_NONE, 0, 0},
+	{"g", ppc64.D_REG, 30, ppc64.D_NONE, 0, 0},
+	{"F31", ppc64.D_FREG, 31, ppc64.D_NONE, 0, 0},
+	{"CR", ppc64.D_CREG, ppc64.NREG, ppc64.D_NONE, 0, 0},
+	{"CR3", ppc64.D_CREG, 3, ppc64.D_NONE, 0, 0},
+	{"LR", ppc64.D_SPR, ppc64.NREG, ppc64.D_NONE, ppc64.D_LR, 0},
+	{"CTR", ppc64.D_SPR, ppc64.NREG, ppc64.D_NONE, ppc64.D_CTR, 0},
+	{"XER", ppc64.D_SPR, ppc64.NREG, ppc64.D_NONE, ppc64.D_XER, 0},
+	{"(CTR)", ppc64.D_SPR, ppc64.NREG, ppc64.D_NONE, ppc64.D_CTR, 0},
+	{"(R3)", ppc64.D_OREG, 3, ppc64.D_NONE, 0, 0},
+	{"-8(R1)", ppc64.D_OREG, 1, ppc64.D_NONE, -8, 0},
+	{"(R3)(R4)", ppc64.D_OREG, 3, ppc64.D_NONE, 0, 4},
+	{"$-1", ppc64.D_CONST, ppc64.NREG, ppc64.D_NONE, -1, 0},
+	{"x+8(FP)", ppc64.D_OREG, ppc64.NREG, ppc64.D_PARAM, 8, 0},
+	{"foo<>+16(SB)", ppc64.D_OREG, ppc64.NREG, ppc64.D_STATIC, 16, 0},
+	{"$foo(SB)", ppc64.D_CONST, ppc64.NREG, ppc64.D_EXTERN, 0, 0},
+}
+
+func TestPPC64Operand(t *testing.T) {
+	arch := archPPC64(&ppc64.Linkppc64)
+	for _, test := range ppc64OperandTests {
+		p := newTestParser(arch)
+		addr := p.address(tokenize(test.input))
+		out := p.addrToAddr(&addr)
+		if p.diag.ErrorCount() != 0 {
+			t.Errorf("%s: unexpected error", test.input)
+			continue
+		}
+		if out.Typ != test.typ || out.Reg != test.reg || out.Name != test.name || out.Offset != test.offset || out.Scale != test.scale {
+			t.Errorf("%s: got typ=%d reg=%d name=%d offset=%d scale=%d; want typ=%d reg=%d name=%d offset=%d scale=%d",
+				test.input, out.Typ, out.Reg, out.Name, out.Offset, out.Scale, test.typ, test.reg, test.name, test.offset, test.scale)
+		}
+	}
+}
+
+var ppc64BadOperandTests = []string{
+	"(F1)",
+	"8(R3)(R4)",
+	"(R3)(F4)",
+	"(R3)(R4)(R5)",
+}
+
+func TestPPC64BadOperand(t *testing.T) {
+	arch := archPPC64(&ppc64.Linkppc64)
+	for _, input := range ppc64BadOperandTests {
+		p := newTestParser(arch)
+		addr := p.address(tokenize(input))
+		p.addrToAddr(&addr)
+		if p.diag.ErrorCount() == 0 {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestPPC64Text(t *testing.T) {
+	arch := archPPC64(&ppc64.Linkppc64)
+	p := newTestParser(arch)
+	p.asmText("TEXT", [][]LexToken{tokenize("foo(SB)"), tokenize("7"), tokenize("$-8-24")})
+	if p.diag.ErrorCount() != 0 {
+		t.Fatal("unexpected error")
+	}
+	prog := p.firstProg
+	if prog.Reg != 7 {
+		t.Errorf("flag: got %d; want 7", prog.Reg)
+	}
+	if prog.To.Typ != ppc64.D_CONST || prog.To.Offset != 24<<32|0xfffffff8 {
+		t.Errorf("frame: got typ=%d offset=%#x; want typ=%d offset=%#x", prog.To.Typ, prog.To.Offset, ppc64.D_CONST, int64(24<<32|0xfffffff8))
+	}
+}
+
+func TestPPC64Corpus(t *testing.T) {
+	testGolden(t, "ppc64", "testdata/ppc64.s")
+}
+
+// Each of these has an operand of a class its instruction does not accept.
+var ppc64BadClassTests = []string{
+	"MOVD R3, $4",
+	"WORD R3",
+	"MOVD (R3), 8(R4)",
+}
+
+func TestPPC64BadClass(t *testing.T) {
+	for _, input := range ppc64BadClassTests {
+		src := "TEXT foo(SB), 0, $0\n" + input + "\n"
+		if obj, _ := Assemble("ppc64", "x.s", strings.NewReader(src), Options{}); obj != nil {
+			t.Errorf("%s: assembled without error", input)
+		}
+	}
+}
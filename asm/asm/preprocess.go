@@ -0,0 +1,128 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+// Preprocess runs only the preprocessor over the source read from r and writes the result
+// to w: the tokens the assembler would see, with macros expanded, conditionals resolved
+// and included files inlined. Line markers record where each line came from, so the output
+// can itself be assembled with the same line numbers. Preprocess returns the names of the
+// included files, as for Object.Includes, or nil if there were errors, and the diagnostics
+// reported. Since the source is not assembled, it need only be valid up to preprocessing.
+func Preprocess(arch, name string, r io.Reader, w io.Writer, opts Options) ([]string, []Diagnostic) {
+	diag := &Diagnostics{
+		Handle:    opts.Handle,
+		MaxErrors: opts.MaxErrors,
+	}
+	a := LookupArch(arch)
+	if a == nil {
+		diag.Report(Diagnostic{File: name, Severity: Error, Msg: fmt.Sprintf("unrecognized architecture %s", arch)})
+		return nil, diag.List
+	}
+	opts.setDefaults(arch)
+	lexer := NewLexer(name, r, liblink.Linknew(a.LinkArch), diag, &opts)
+	out := bufio.NewWriter(w)
+	ok := preprocess(lexer, &tokenWriter{w: out, file: name, line: 1})
+	if err := out.Flush(); err != nil {
+		diag.Report(Diagnostic{File: name, Severity: Error, Msg: fmt.Sprintf("writing preprocessed source: %v", err)})
+	}
+	if !ok || diag.ErrorCount() > 0 {
+		return nil, diag.List
+	}
+	return lexer.Included(), diag.List
+}
+
+// preprocess reads the input to EOF, writing each token to w. It reports false if an error stopped it.
+func preprocess(in *Input, w *tokenWriter) (ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, isBailout := e.(bailout); !isBailout {
+				panic(e)
+			}
+			ok = false
+		}
+	}()
+	for tok := in.Next(); tok != scanner.EOF; tok = in.Next() {
+		w.write(in, LexToken{Token: tok, text: in.Text()})
+	}
+	return true
+}
+
+// A tokenWriter reconstructs source text from the stream of tokens. The original spacing
+// is gone, so it puts spaces where they are needed to keep the tokens apart, and after
+// the instruction and commas for legibility.
+type tokenWriter struct {
+	w     *bufio.Writer
+	file  string // Position of the next line to be written.
+	line  int
+	prev  LexToken // Previous token on the line.
+	count int      // Number of tokens on the line so far.
+}
+
+// maxBlankLines is the largest gap in line numbers that is filled with blank lines
+// rather than a line marker.
+const maxBlankLines = 8
+
+func (t *tokenWriter) write(in *Input, tok LexToken) {
+	if tok.Token == '\n' {
+		t.w.WriteByte('\n')
+		t.line++
+		t.count = 0
+		return
+	}
+	if t.count == 0 {
+		t.position(in.FileName(), in.Line())
+	} else if t.space(tok) {
+		t.w.WriteByte(' ')
+	}
+	t.w.WriteString(tok.text)
+	t.prev = tok
+	t.count++
+}
+
+// position moves the output to the given line of the file, for the start of a line.
+func (t *tokenWriter) position(file string, line int) {
+	if file == t.file && line >= t.line && line-t.line <= maxBlankLines {
+		for ; t.line < line; t.line++ {
+			t.w.WriteByte('\n')
+		}
+		return
+	}
+	// The newline that ends the #line directive advances the line number,
+	// so the marker names the line before.
+	fmt.Fprintf(t.w, "#line %d %s\n", line-1, strconv.Quote(file))
+	t.file = file
+	t.line = line
+}
+
+// space reports whether a space should separate the previous token from tok.
+func (t *tokenWriter) space(tok LexToken) bool {
+	switch {
+	case t.prev.Token == ',', t.prev.Token == ';':
+		return true
+	case t.count == 1 && tok.Token != ':':
+		// After the instruction, but not in a label definition.
+		return true
+	case t.count == 2 && t.prev.Token == ':':
+		// After a label definition.
+		return true
+	}
+	// Would the two tokens read back as they are?
+	pair := tokenize(t.prev.text + tok.text)
+	return len(pair) != 2 || !sameToken(pair[0], t.prev) || !sameToken(pair[1], tok)
+}
+
+func sameToken(a, b LexToken) bool {
+	return a.Token == b.Token && a.text == b.text
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/scanner"
+
+	"code.google.com/p/rsc/c2go/liblink"
+)
+
+var preprocessTests = []struct {
+	name   string
+	input  string
+	output string
+}{
+	{
+		"instructions",
+		"TEXT ·f(SB),7,$0-8\nloop:\tMOVQ\tx+0(FP), AX // Comment.\n\tJMP loop\n",
+		"TEXT ·f(SB), 7, $0-8\nloop: MOVQ x+0(FP), AX\nJMP loop\n",
+	},
+	{
+		"macros",
+		"#define LOAD(off, r) MOVQ off(SP), r\n#define N 8\n\tLOAD(N, AX)\n\tSHLQ $(N<<1), AX\n",
+		"\n\nMOVQ 8(SP), AX\nSHLQ $(8<<1), AX\n",
+	},
+	{
+		"conditionals",
+		"#ifdef X\nA\n#else\nB\n#endif\nC\n",
+		"\n\n\nB\n\nC\n",
+	},
+	{
+		"long conditional",
+		"#if 0\n\n\n\n\n\n\n\n\n\n#endif\nA\n",
+		"#line 11 \"x.s\"\nA\n",
+	},
+	{
+		"tokens kept apart",
+		"MOVQ $1.5, X0; B a . b, < <, -1\n",
+		"MOVQ $1.5, X0; B a.b, < <, -1\n",
+	},
+}
+
+func TestPreprocess(t *testing.T) {
+	for _, test := range preprocessTests {
+		var buf bytes.Buffer
+		includes, diags := Preprocess("amd64", "x.s", strings.NewReader(test.input), &buf, Options{})
+		if includes == nil {
+			t.Errorf("%s: %v", test.name, diags)
+			continue
+		}
+		if buf.String() != test.output {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, buf.String(), test.output)
+		}
+		testReread(t, test.name, "x.s", test.input, buf.String())
+	}
+}
+
+func TestPreprocessInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	header := "#define R AX\nMOVQ R, BX\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.h"), []byte(header), 0666); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "x.s")
+	src := "A\n#include \"a.h\"\nINCQ R\n"
+	var buf bytes.Buffer
+	if includes, diags := Preprocess("amd64", name, strings.NewReader(src), &buf, Options{}); includes == nil {
+		t.Fatal(diags)
+	}
+	want := fmt.Sprintf("A\n#line 1 %q\nMOVQ AX, BX\n#line 2 %q\nINCQ AX\n", "a.h", name)
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	testReread(t, "include", name, src, buf.String())
+}
+
+// testReread checks that the preprocessed output reads back as the same tokens
+// at the same positions as the input.
+func testReread(t *testing.T, test, name, input, output string) {
+	in, out := tokenPositions(name, input), tokenPositions(name, output)
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("%s: preprocessed output reads as\n%q\nwant\n%q", test, out, in)
+	}
+}
+
+// tokenPositions returns the tokens of the preprocessed source, each prefixed by its position.
+func tokenPositions(name, src string) []string {
+	ctxt := liblink.Linknew(LookupArch("amd64").LinkArch)
+	in := NewLexer(name, strings.NewReader(src), ctxt, &Diagnostics{}, &Options{})
+	var toks []string
+	for tok := in.Next(); tok != scanner.EOF; tok = in.Next() {
+		if tok != '\n' {
+			toks = append(toks, fmt.Sprintf("%s:%d %s", in.FileName(), in.Line(), in.Text()))
+		}
+	}
+	return toks
+}
@@ -0,0 +1,196 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Symbol describes a symbol that the source defines or refers to.
+type Symbol struct {
+	Name   string // As written in the source, without <>.
+	Kind   SymbolKind
+	Static bool  // Whether the symbol is local to the file: foo<>(SB).
+	Size   int64 // The size declared by GLOBL, or the frame size declared by TEXT.
+	Flags  int   // The flag operand of TEXT or GLOBL.
+}
+
+// A SymbolKind says how a Symbol is defined.
+type SymbolKind int
+
+const (
+	SymbolUndefined SymbolKind = iota // Referred to but not defined in the source.
+	SymbolText                        // Defined by TEXT.
+	SymbolData                        // Defined by GLOBL and initialized by DATA.
+	SymbolBSS                         // Defined by GLOBL alone, so zeroed.
+)
+
+var symbolKinds = [...]string{
+	SymbolUndefined: "undefined",
+	SymbolText:      "text",
+	SymbolData:      "data",
+	SymbolBSS:       "bss",
+}
+
+func (k SymbolKind) String() string {
+	if 0 <= k && int(k) < len(symbolKinds) {
+		return symbolKinds[k]
+	}
+	return fmt.Sprintf("SymbolKind(%d)", int(k))
+}
+
+func (s Symbol) String() string {
+	name := s.Name
+	if s.Static {
+		name += "<>"
+	}
+	return fmt.Sprintf("%s %s size=%d flags=%d", name, s.Kind, s.Size, s.Flags)
+}
+
+// The flags of TEXT and GLOBL, from textflag.h.
+const (
+	flagNOPROF   = 1
+	flagDUPOK    = 2
+	flagNOSPLIT  = 4
+	flagRODATA   = 8
+	flagNOPTR    = 16
+	flagWRAPPER  = 32
+	flagNEEDCTXT = 64
+)
+
+// textFlags are the flags that mean nothing to GLOBL.
+var textFlags = []struct {
+	flag int
+	name string
+}{
+	{flagNOPROF, "NOPROF"},
+	{flagNOSPLIT, "NOSPLIT"},
+	{flagWRAPPER, "WRAPPER"},
+	{flagNEEDCTXT, "NEEDCTXT"},
+}
+
+// symbolInfo is what the Parser learns about a symbol, to check its
+// definition at the end of the source.
+type symbolInfo struct {
+	Symbol
+	text    *Patch // The TEXT defining the symbol, if any.
+	globl   *Patch // The GLOBL defining the symbol, if any.
+	data    *Patch // The first DATA for the symbol, if any.
+	dataEnd int64  // The end of the last DATA, and where it is.
+	last    Patch
+	addr    string // The name of a symbol whose address a DATA stores, if any, and where.
+	addrAt  Patch
+}
+
+// symbol returns the information about the SB symbol named in a, creating it if needed.
+func (p *Parser) symbol(a *Addr) *symbolInfo {
+	key := linkName(a.symbol)
+	if a.isStatic {
+		key += "<>"
+	}
+	sym := p.symbols[key]
+	if sym == nil {
+		sym = &symbolInfo{Symbol: Symbol{Name: a.symbol, Static: a.isStatic}}
+		p.symbols[key] = sym
+	}
+	return sym
+}
+
+// defineText records that TEXT defines the symbol named in a.
+func (p *Parser) defineText(a *Addr, flag int8, frame int64) {
+	p.at = p.inst // Diagnostics refer to the whole pseudo-op.
+	sym := p.symbol(a)
+	switch {
+	case sym.text != nil:
+		p.errorf("%s redefined; previous TEXT at %s", a.symbol, sym.text.position())
+	case sym.globl != nil:
+		p.errorf("%s is declared as data by GLOBL at %s", a.symbol, sym.globl.position())
+	}
+	text := p.newPatch(nil, "")
+	sym.text = &text
+	sym.Kind, sym.Flags, sym.Size = SymbolText, int(flag), frame
+}
+
+// defineGlobl records that GLOBL defines the symbol named in a.
+func (p *Parser) defineGlobl(a *Addr, flag int8, size int64) {
+	p.at = p.inst // Diagnostics refer to the whole pseudo-op.
+	sym := p.symbol(a)
+	switch {
+	case size < 0:
+		p.errorf("GLOBL %s: size %d is negative", a.symbol, size)
+	case sym.globl != nil:
+		p.errorf("%s redeclared; previous GLOBL at %s", a.symbol, sym.globl.position())
+	case sym.text != nil:
+		p.errorf("%s is defined as text by TEXT at %s", a.symbol, sym.text.position())
+	}
+	for _, f := range textFlags {
+		if int(flag)&f.flag != 0 {
+			p.warnf("GLOBL %s: flag %s applies only to TEXT", a.symbol, f.name)
+		}
+	}
+	globl := p.newPatch(nil, "")
+	sym.globl = &globl
+	sym.Flags, sym.Size = int(flag), size
+}
+
+// recordData records a DATA of size bytes at the offset in a. The value stored is in value.
+func (p *Parser) recordData(a *Addr, size int, value *Addr) {
+	p.at = p.inst // Diagnostics refer to the whole pseudo-op.
+	sym := p.symbol(a)
+	here := p.newPatch(nil, "")
+	if sym.data == nil {
+		sym.data = &here
+	}
+	if end := a.offset + int64(size); end > sym.dataEnd {
+		sym.dataEnd, sym.last = end, here
+	}
+	if value.isImmediateAddress && value.has(addrSymbol) && sym.addr == "" {
+		sym.addr, sym.addrAt = value.symbol, here
+	}
+}
+
+// checkSymbols checks the DATA for each symbol against its GLOBL, once the whole
+// source has been read.
+func (p *Parser) checkSymbols() {
+	for _, key := range p.symbolKeys() {
+		sym := p.symbols[key]
+		switch {
+		case sym.data != nil && sym.globl == nil:
+			p.reportAt(*sym.data, Error, "DATA for %s, which has no GLOBL", sym.Name)
+		case sym.data != nil && sym.dataEnd > sym.Size:
+			p.reportAt(sym.last, Error, "DATA for %s ends at offset %d, beyond its GLOBL size %d", sym.Name, sym.dataEnd, sym.Size)
+		case sym.data == nil && sym.globl != nil && sym.Flags&flagRODATA != 0:
+			p.reportAt(*sym.globl, Warning, "RODATA symbol %s has no DATA", sym.Name)
+		}
+		if sym.addr != "" && sym.globl != nil && sym.Flags&flagNOPTR != 0 {
+			p.reportAt(sym.addrAt, Warning, "NOPTR symbol %s holds the address of %s; the garbage collector will not see it", sym.Name, sym.addr)
+		}
+		if sym.globl != nil {
+			sym.Kind = SymbolBSS
+			if sym.data != nil {
+				sym.Kind = SymbolData
+			}
+		}
+	}
+}
+
+// Symbols returns the symbols the source defines and refers to, sorted by name.
+func (p *Parser) Symbols() []Symbol {
+	var syms []Symbol
+	for _, key := range p.symbolKeys() {
+		syms = append(syms, p.symbols[key].Symbol)
+	}
+	return syms
+}
+
+func (p *Parser) symbolKeys() []string {
+	keys := make([]string, 0, len(p.symbols))
+	for key := range p.symbols {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
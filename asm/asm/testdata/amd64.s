@@ -0,0 +1,45 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A corpus of amd64 instruction forms; it should assemble without error.
+
+TEXT	foo(SB), 7, $16-16
+	MOVQ	AX, BX
+	MOVQ	$1, AX
+	MOVQ	$-1, AX
+	MOVQ	8(SP), AX
+	MOVQ	x+0(FP), AX
+	MOVQ	y-8(SP), CX
+	MOVQ	SP, DX
+	LEAQ	y-8(SP), DX
+	MOVQ	$8(SP), DX
+	MOVQ	(AX)(BX*8), CX
+	MOVQ	16(AX)(BX*8), CX
+	LEAQ	0(BX*8), CX
+	MOVQ	$foo(SB), AX
+	MOVQ	tab<>(SB), AX
+	MOVQ	tab<>+8(SB), AX
+	MOVQ	tab<>+8(SB)(CX*4), AX
+	MOVSD	$1.5, X0
+	INCQ	AX
+	PUSHQ	BX
+	SHLQ	$4, DX:AX
+	SHLQ	$4, AX, DX
+	SHLQ	$4, AX
+	SHRL	CX, (BX)
+	CMPPS	X1, X0, 4
+	IMUL3Q	$5, AX, BX
+	PSHUFL	$0x1b, X1, X2
+	CMPQ	AX, $0
+	JEQ	done
+	CALL	runtime·morestack(SB)
+	JMP	2(PC)
+	NOP
+done:
+	MOVQ	CX, ret+8(FP)
+	RET
+
+DATA	tab<>+0(SB)/8, $1
+DATA	tab<>+8(SB)/8, $"abcdefgh"
+GLOBL	tab<>(SB), 8, $16
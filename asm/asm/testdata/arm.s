@@ -0,0 +1,33 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A corpus of ARM instruction forms; it should assemble without error.
+
+TEXT	foo(SB), 7, $0-8
+	MOVW	x+0(FP), R1
+	MOVW	$1, R2
+	MOVW.EQ	R1, R2
+	MOVW.P	4(R1), R2
+	MOVW.W	R2, -4(R13)
+	MOVB	R1, (R2)
+	ADD	R1, R2, R3
+	ADD.S	$1, R2
+	SUB	R1<<2, R2, R3
+	AND	R1->R4, R3
+	ORR	R1@>3, R3
+	MOVM.IA	[R0-R3,R5], (R1)
+	MOVM.DB.W	(R13), [R4-R11]
+	MULLU	R1, R2, (R4, R3)
+	MULA	R1, R2, R3, R4
+	MOVW	CPSR, R1
+	MOVD	F1, F2
+	ADDD	F1, F2, F3
+	CMP	$0, R1
+	BEQ	done
+	BL	bar(SB)
+	B	2(PC)
+	SWI	$0
+done:
+	MOVW	R1, ret+4(FP)
+	RET
@@ -0,0 +1,42 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A corpus of ppc64 instruction forms, one or two per class;
+// it should assemble without error.
+
+TEXT	foo(SB), 7, $16-24
+	// Loads and stores.
+	MOVD	x+0(FP), R3
+	MOVW	8(R3), R4
+	MOVBZ	(R3)(R4), R5
+	MOVD	R5, -8(R1)
+	MOVD	$foo(SB), R6
+	// Arithmetic.
+	ADD	R3, R4, R5
+	ADD	$-1, R5
+	MULLD	R3, R4
+	RLWNM	$3, R4, $0xff, R5
+	// Floating point.
+	FMOVD	F1, F2
+	FADD	F1, F2, F3
+	FMADD	F1, F2, F3, F4
+	// Special registers.
+	MOVD	LR, R3
+	MOVD	R3, CTR
+	MOVFL	R3, CR
+	// Branches.
+	CMP	R3, R4
+	CMP	R3, $4
+	BEQ	done
+	BNE	CR1, done
+	BC	12, 2, done
+	BL	bar(SB)
+	BR	(CTR)
+done:
+	MOVD	R5, ret+16(FP)
+	RETURN
+
+// A leaf with no frame, whose negative frame size is masked into the TEXT.
+TEXT	leaf(SB), 7, $-8-0
+	RETURN
@@ -0,0 +1,88 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package asm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Trace is a set of categories of tracing output; see Options.Trace.
+type Trace int
+
+const (
+	TraceLex   Trace = 1 << iota // Preprocessor directives: #include, #line, #define and #undef.
+	TraceParse                   // Each label and statement, as split into instruction and operands.
+	TraceLink                    // Each Prog handed to the linker library.
+)
+
+var traceNames = []struct {
+	trace Trace
+	name  string
+}{
+	{TraceLex, "lex"},
+	{TraceParse, "parse"},
+	{TraceLink, "link"},
+}
+
+// ParseTrace parses a comma-separated list of trace categories, such as "lex,link".
+func ParseTrace(s string) (Trace, error) {
+	var t Trace
+	if s == "" {
+		return t, nil
+	}
+Categories:
+	for _, name := range strings.Split(s, ",") {
+		for _, n := range traceNames {
+			if n.name == name {
+				t |= n.trace
+				continue Categories
+			}
+		}
+		return 0, fmt.Errorf("unknown trace category %q; want lex, parse or link", name)
+	}
+	return t, nil
+}
+
+func (t Trace) String() string {
+	var names []string
+	for _, n := range traceNames {
+		if t&n.trace != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// A tracer writes the trace. Each line is a position, the category and the
+// event, as in "x.s:12: link: 00005 (x.s:12) MOVQ AX, BX". A nil tracer
+// traces nothing, so the lexer and parser need not check for one.
+type tracer struct {
+	w     io.Writer
+	trace Trace
+}
+
+// newTracer returns the tracer the options ask for, or nil if there is none.
+func newTracer(opts *Options) *tracer {
+	if opts.TraceOut == nil || opts.Trace == 0 {
+		return nil
+	}
+	return &tracer{w: opts.TraceOut, trace: opts.Trace}
+}
+
+// enabled reports whether the category is being traced. Callers use it to
+// avoid formatting an event nobody will see.
+func (t *tracer) enabled(category Trace) bool {
+	return t != nil && t.trace&category != 0
+}
+
+// printf traces an event of the category at the position.
+func (t *tracer) printf(category Trace, file string, line int, format string, args ...interface{}) {
+	if !t.enabled(category) {
+		return
+	}
+	fmt.Fprintf(t.w, "%s:%d: %s: %s\n", file, line, category, fmt.Sprintf(format, args...))
+}
@@ -2,24 +2,37 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Asm is the Go assembler. It is a thin client of package asm, which does the work.
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/build"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
-	"code.google.com/p/rsc/c2go/liblink"
+	"code.google.com/p/rspace/asm/asm"
 )
 
 var (
-	outputFile = flag.String("o", "", "output file; default foo.6 for /a/b/c/foo.s on arm64 (unused TODO)")
-	printOut   = flag.Bool("S", true, "print assembly and machine code") // TODO: set to false
-	trimPath   = flag.String("trimpath", "", "remove prefix from recorded source file paths (unused TODO)")
+	outputFile = flag.String("o", "", "output file or directory; default foo.6 for /a/b/c/foo.s on amd64; - means standard output")
+	printOut   = flag.Bool("S", false, "print assembly and machine code")
+	listOut    = flag.Bool("l", false, "print a listing of the program in assembler syntax, with PCs and machine code")
+	trimPath   = flag.String("trimpath", "", "remove prefix from recorded source file paths")
+	maxErrors  = flag.Int("maxerrors", 10, "stop after this many errors; 0 means no limit")
+	preprocOut = flag.Bool("E", false, "write the preprocessed source to standard output, instead of assembling; -M takes precedence")
+	depsOnly   = flag.Bool("M", false, "write a make-style list of the files the source includes, instead of assembling")
+	depsFile   = flag.String("MF", "", "write the list of included files to this file; with -M, instead of standard output")
+	symbolsOut = flag.Bool("symbols", false, "print a table of the symbols the source defines and refers to, with kind, size and static or extern status")
+	traceFlag  = flag.String("trace", "", "comma-separated categories of tracing to write to standard error: lex, parse, link")
+	dialect    = flag.String("dialect", "go", "syntax of the source: go, or gnu for GNU AT&T syntax on 386 and amd64")
 )
 
 func init() {
@@ -37,45 +50,178 @@ func main() {
 		flag.Usage()
 	}
 
-	arch := setArch(build.Default.GOARCH)
+	arch := asm.LookupArch(build.Default.GOARCH)
+	if arch == nil {
+		log.Fatalf("unrecognized architecture %s", build.Default.GOARCH)
+	}
 
-	// Flag refinement.
-	if *outputFile == "" {
-		input := filepath.Base(flag.Arg(0))
-		if strings.HasSuffix(input, ".s") {
-			input = input[:len(input)-2]
-		}
-		*outputFile = fmt.Sprintf("%s.%c", input, arch.Thechar)
+	objName := objectName(flag.Arg(0), arch)
+	trace, err := asm.ParseTrace(*traceFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	syntax, err := asm.ParseDialect(*dialect)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Create object file, write header.
-	fd, err := os.Create(*outputFile)
+	fd, err := os.Open(flag.Arg(0))
 	if err != nil {
 		log.Fatal(err)
 	}
-	ctxt := liblink.Linknew(arch.LinkArch)
+	defer fd.Close()
+	opts := asm.Options{
+		Defines:     dFlag,
+		IncludeDirs: iFlag,
+		TrimPath:    *trimPath,
+		MaxErrors:   *maxErrors,
+		Handle: func(d asm.Diagnostic) {
+			fmt.Fprintln(os.Stderr, d)
+		},
+		Dialect:  syntax,
+		Trace:    trace,
+		TraceOut: os.Stderr,
+		GOOS:     build.Default.GOOS,
+		GOARCH:   build.Default.GOARCH,
+	}
 	if *printOut {
-		ctxt.Debugasm = 1
-	}
-	ctxt.Bso = liblink.Binitw(os.Stdout)
-	defer liblink.Bflush(ctxt.Bso)
-	ctxt.Diag = log.Fatalf
-	output := liblink.Binitw(fd)
-	liblink.Bprint(output, "go object %s %s %s\n", liblink.Getgoos(), liblink.Getgoarch(), liblink.Getgoversion())
-	liblink.Bprint(output, "!\n")
-
-	lexer := NewLexer(flag.Arg(0), ctxt, dFlag, iFlag)
-	parser := NewParser(ctxt, arch, lexer)
-	pList := liblink.Linknewplist(ctxt)
-	var ok bool
-	pList.Firstpc, ok = parser.Parse()
-	if !ok {
-		log.Print("FAIL TODO")
+		if objName == "-" {
+			// Keep the debugging output out of the object.
+			opts.Debug = os.Stderr
+		} else {
+			opts.Debug = os.Stdout
+		}
+	}
+	if *listOut {
+		if objName == "-" {
+			opts.List = os.Stderr
+		} else {
+			opts.List = os.Stdout
+		}
+	}
+	if *depsOnly || *preprocOut {
+		var includes []string
+		if *depsOnly {
+			includes, _ = asm.Dependencies(build.Default.GOARCH, flag.Arg(0), fd, opts)
+		} else {
+			includes, _ = asm.Preprocess(build.Default.GOARCH, flag.Arg(0), fd, os.Stdout, opts)
+		}
+		if includes == nil {
+			os.Exit(1)
+		}
+		if *depsOnly || *depsFile != "" {
+			if err := writeDependencies(*depsFile, objName, flag.Arg(0), includes); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+	obj, _ := asm.Assemble(build.Default.GOARCH, flag.Arg(0), fd, opts)
+	if obj == nil {
 		os.Exit(1)
 	}
-	liblink.Writeobj(ctxt, output)
-	liblink.Bflush(output)
-	log.Print("OK")
+	if err := writeObject(objName, obj.Data); err != nil {
+		log.Fatal(err)
+	}
+	if *depsFile != "" {
+		if err := writeDependencies(*depsFile, objName, flag.Arg(0), obj.Includes); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *symbolsOut {
+		w := os.Stdout
+		if objName == "-" {
+			w = os.Stderr
+		}
+		if err := writeSymbols(w, obj.Symbols); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// objectName returns the name of the object file for the named source file,
+// as set by the -o flag: a file, a directory to hold the default name, or - for
+// standard output. The default name is foo.6 for /a/b/c/foo.s on amd64.
+func objectName(input string, arch *asm.Arch) string {
+	base := filepath.Base(input)
+	if strings.HasSuffix(base, ".s") {
+		base = base[:len(base)-2]
+	}
+	base = fmt.Sprintf("%s.%c", base, arch.Thechar)
+	switch {
+	case *outputFile == "":
+		return base
+	case *outputFile == "-":
+		return "-"
+	case strings.HasSuffix(*outputFile, string(filepath.Separator)):
+		return filepath.Join(*outputFile, base)
+	}
+	if info, err := os.Stat(*outputFile); err == nil && info.IsDir() {
+		return filepath.Join(*outputFile, base)
+	}
+	return *outputFile
+}
+
+// writeObject writes the object to the named file, or to standard output if the name is -.
+// A file is written to a temporary name alongside it and renamed into place, so
+// readers never see a partial object, even if the assembler is interrupted.
+func writeObject(name string, obj []byte) error {
+	if name == "-" {
+		_, err := os.Stdout.Write(obj)
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp%d", name, os.Getpid())
+	fd, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(obj)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// writeDependencies writes to the named file, or to standard output if the name is empty,
+// a make rule saying that the object depends on the source and the files it includes.
+func writeDependencies(name, object, source string, includes []string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:", makeQuote(object))
+	for _, file := range append([]string{source}, includes...) {
+		fmt.Fprintf(&buf, " \\\n\t%s", makeQuote(file))
+	}
+	buf.WriteString("\n")
+	if name == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(name, buf.Bytes(), 0666)
+}
+
+// writeSymbols writes a table of the symbols, one per line: name, kind, size,
+// whether the symbol is static or extern, and flags.
+func writeSymbols(w io.Writer, syms []asm.Symbol) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tKIND\tSIZE\tSCOPE\tFLAGS\n")
+	for _, sym := range syms {
+		name, scope := sym.Name, "extern"
+		if sym.Static {
+			name, scope = name+"<>", "static"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\n", name, sym.Kind, sym.Size, scope, sym.Flags)
+	}
+	return tw.Flush()
+}
+
+// makeQuote escapes the characters that are special in a make rule's file names.
+func makeQuote(name string) string {
+	return strings.NewReplacer(" ", "\\ ", "#", "\\#", "$", "$$").Replace(name)
 }
 
 var (
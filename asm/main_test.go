@@ -0,0 +1,121 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.google.com/p/rspace/asm/asm"
+)
+
+func TestObjectName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	arch := asm.LookupArch("amd64")
+	saved := *outputFile
+	defer func() { *outputFile = saved }()
+	tests := []struct {
+		flag, input, output string
+	}{
+		{"", "/a/b/c/foo.s", "foo.6"},
+		{"", "bar", "bar.6"},
+		{"-", "foo.s", "-"},
+		{"x.o", "foo.s", "x.o"},
+		{dir, "/a/b/c/foo.s", filepath.Join(dir, "foo.6")},
+		{"obj" + string(filepath.Separator), "foo.s", filepath.Join("obj", "foo.6")},
+	}
+	for _, test := range tests {
+		*outputFile = test.flag
+		if got := objectName(test.input, arch); got != test.output {
+			t.Errorf("-o=%q %s: got %q; want %q", test.flag, test.input, got, test.output)
+		}
+	}
+}
+
+func TestWriteObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "foo.6")
+	if err := ioutil.WriteFile(name, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeObject(name, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("got %q; want %q", data, "new")
+	}
+	// Only the object should remain; the temporary file has been renamed.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files in output directory; want 1", len(files))
+	}
+	// A failed rename leaves nothing behind. A directory in the way makes it fail.
+	bad := filepath.Join(dir, "bad.6")
+	if err := os.MkdirAll(filepath.Join(bad, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeObject(bad, []byte("x")); err == nil {
+		t.Errorf("expected error renaming onto a directory")
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmps) != 0 {
+		t.Errorf("temporary files left behind: %q", tmps)
+	}
+}
+
+func TestWriteDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "foo.d")
+	err = writeDependencies(name, "foo.6", "foo.s", []string{"textflag.h", "../my dir/$x.h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "foo.6: \\\n\tfoo.s \\\n\ttextflag.h \\\n\t../my\\ dir/$$x.h\n"
+	if string(data) != want {
+		t.Errorf("got %q; want %q", data, want)
+	}
+}
+
+func TestWriteSymbols(t *testing.T) {
+	syms := []asm.Symbol{
+		{Name: "runtime·memmove", Kind: asm.SymbolText, Size: 0, Flags: 4},
+		{Name: "table", Kind: asm.SymbolData, Static: true, Size: 16, Flags: 8},
+	}
+	var buf bytes.Buffer
+	if err := writeSymbols(&buf, syms); err != nil {
+		t.Fatal(err)
+	}
+	want := "NAME            KIND SIZE SCOPE  FLAGS\n" +
+		"runtime·memmove text 0    extern 4\n" +
+		"table<>         data 16   static 8\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}